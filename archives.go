@@ -0,0 +1,131 @@
+package main
+
+import (
+	"hash"
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Kinds of archive artifacts listed in a bookmark's `archives` field.
+const (
+	archiveMarkdown   = "markdown"   // an article's readable text
+	archiveMedia      = "media"      // a podcast's or video's file
+	archiveSingleFile = "singlefile" // an article's SingleFile HTML snapshot
+	archiveWARC       = "warc"       // an article's WARC capture
+	archiveWayback    = "wayback"    // the Wayback Machine snapshot from Save Page Now
+)
+
+const (
+	artifactOK     = "ok"
+	artifactFailed = "failed"
+)
+
+// archiveFileFields maps artifact kinds to the file field holding them when
+// ASSET_STORAGE=file.
+var archiveFileFields = map[string]string{
+	archiveMarkdown:   "archive_file",
+	archiveMedia:      "archive_file",
+	archiveSingleFile: "snapshot_file",
+	archiveWARC:       "warc_file",
+}
+
+// archiveArtifact is one entry of a bookmark's `archives` field: a file archived for
+// it, or the attempt to. Stored files have a URL, or with ASSET_STORAGE=file, the
+// file field and name they're attached under.
+type archiveArtifact struct {
+	Kind        string         `json:"kind"`
+	Status      string         `json:"status"`
+	URL         string         `json:"url,omitempty"`
+	Field       string         `json:"field,omitempty"`
+	File        string         `json:"file,omitempty"`
+	Size        int64          `json:"size,omitempty"`
+	Hash        string         `json:"hash,omitempty"`
+	ContentType string         `json:"content_type,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Created     types.DateTime `json:"created"`
+}
+
+// assetArtifact lists an asset stored through assetStore.
+func assetArtifact(kind string, asset *core.Record) archiveArtifact {
+	return archiveArtifact{
+		Kind:        kind,
+		Status:      artifactOK,
+		URL:         asset.GetString("url"),
+		Size:        int64(asset.GetInt("size")),
+		Hash:        asset.GetString("hash"),
+		ContentType: asset.GetString("content_type"),
+		Created:     types.NowDateTime(),
+	}
+}
+
+// fileArtifact lists a file attached to one of the record's file fields.
+func fileArtifact(kind, field, name, contentType string, size int64, hash string) archiveArtifact {
+	return archiveArtifact{
+		Kind:        kind,
+		Status:      artifactOK,
+		Field:       field,
+		File:        name,
+		Size:        size,
+		Hash:        hash,
+		ContentType: contentType,
+		Created:     types.NowDateTime(),
+	}
+}
+
+// failedArtifact lists an artifact that couldn't be archived, so it can be retried.
+func failedArtifact(kind string, err error) archiveArtifact {
+	return archiveArtifact{Kind: kind, Status: artifactFailed, Error: err.Error(), Created: types.NowDateTime()}
+}
+
+// recordArtifacts reads a bookmark's `archives` field.
+func recordArtifacts(r *core.Record) []archiveArtifact {
+	var artifacts []archiveArtifact
+	if err := r.UnmarshalJSONField("archives", &artifacts); err != nil {
+		return nil
+	}
+	return artifacts
+}
+
+// findArtifact returns the first artifact of kind, or nil.
+func findArtifact(artifacts []archiveArtifact, kind string) *archiveArtifact {
+	i := slices.IndexFunc(artifacts, func(a archiveArtifact) bool { return a.Kind == kind })
+	if i < 0 {
+		return nil
+	}
+	return &artifacts[i]
+}
+
+// keptArtifact returns the artifact of kind from a bookmark's previous archives list
+// when it was stored alongside the same archive content as primary, in the same
+// storage mode (files is ASSET_STORAGE=file), so it needn't be captured again.
+func keptArtifact(previous []archiveArtifact, primary archiveArtifact, kind string, files bool) (archiveArtifact, bool) {
+	last := findArtifact(previous, primary.Kind)
+	prev := findArtifact(previous, kind)
+	if last == nil || last.Hash != primary.Hash || prev == nil || prev.Status != artifactOK {
+		return archiveArtifact{}, false
+	}
+	if _, stored := archiveFileFields[kind]; stored && (prev.File != "") != files {
+		return archiveArtifact{}, false
+	}
+	return *prev, true
+}
+
+// hasFailedArtifacts reports whether any of the record's archive artifacts failed.
+func hasFailedArtifacts(r *core.Record) bool {
+	return slices.ContainsFunc(recordArtifacts(r), func(a archiveArtifact) bool {
+		return a.Status == artifactFailed
+	})
+}
+
+// countingHash is a hash that also counts the bytes written to it.
+type countingHash struct {
+	hash.Hash
+	n int64
+}
+
+func (c *countingHash) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return c.Hash.Write(p)
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fourjuaneight/rivendell/helpers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const assetsCollection = "_assets"
+
+// assetFields lists, per collection, the fields holding URLs of mirrored assets.
+// These references keep an asset alive; once none is left it's deleted from storage.
+var assetFields = map[string][]string{
+	"bookmarks": {"archive"},
+	"books":     {"cover"},
+	"cds":       {"cover"},
+	"games":     {"cover"},
+	"movies":    {"cover"},
+	"mtg":       {"image", "back"},
+	"shows":     {"cover"},
+	"vinyls":    {"cover"},
+}
+
+// signedURLTTL is how long a download URL handed out by the archive route stays valid.
+const signedURLTTL = 10 * time.Minute
+
+// versionDeleter is implemented by backends that can delete an object by the file ID
+// recorded at upload (B2), skipping the lookup Delete needs.
+type versionDeleter interface {
+	DeleteVersion(key, fileID string) error
+}
+
+// assetStore mirrors files into storage under content-addressed names and records
+// each upload in the _assets collection, so identical content (the same cover for two
+// titles, a bookmark archived twice) is stored once and reuses the first URL.
+//
+// With files set (ASSET_STORAGE=file), assets are attached to the record's file
+// fields instead (e.g. "cover_file"), so they live in PocketBase's own filesystem.
+type assetStore struct {
+	app   core.App
+	store helpers.Storage
+	files bool
+
+	spoolMu sync.Mutex
+	spooled map[string][]string // record ID → temp dirs holding files attached to it
+}
+
+func newAssetStore(app core.App, store helpers.Storage) *assetStore {
+	return &assetStore{app: app, store: store, spooled: map[string][]string{}}
+}
+
+// put stores r as filename in the collection's folder and returns its URL. The content
+// hash is added to filename (see helpers.HashedName); when the same content was already
+// stored, nothing is uploaded and the existing URL is returned. parent is the URL of
+// the asset this one accompanies (e.g. an article's SingleFile snapshot), so it's
+// deleted along with it; "" for assets referenced directly by a record.
+func (a *assetStore) put(collection, filename string, r io.Reader, contentType, parent string) (string, error) {
+	asset, err := a.putAsset(collection, filename, r, contentType, parent)
+	if err != nil {
+		return "", err
+	}
+	return asset.GetString("url"), nil
+}
+
+// putAsset is put returning the asset's _assets record, for its size and hash.
+func (a *assetStore) putAsset(collection, filename string, r io.Reader, contentType, parent string) (*core.Record, error) {
+	// Spool to disk while hashing: the hash is needed for the key before uploading.
+	tmp, err := os.CreateTemp("", "rivendell-asset-*")
+	if err != nil {
+		return nil, fmt.Errorf("[assetStore.put][os.CreateTemp]: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha1.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if err != nil {
+		return nil, fmt.Errorf("[assetStore.put][io.Copy]: %w", err)
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	existing, err := a.find("hash", hash)
+	if err != nil {
+		return nil, fmt.Errorf("[assetStore.put]%w", err)
+	}
+	if existing != nil {
+		log.Printf("[assetStore.put]: '%s' matches stored '%s'.\n", filename, existing.GetString("key"))
+		// The same snapshot can accompany two articles' archives: share it with parent,
+		// so releasing the other archive doesn't delete it.
+		if parent != "" {
+			if err := a.adopt([]string{existing.GetString("url")}, parent, ""); err != nil {
+				return nil, fmt.Errorf("[assetStore.put]%w", err)
+			}
+		}
+		return existing, nil
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("[assetStore.put][Seek]: %w", err)
+	}
+
+	key := helpers.ObjectKey(collection, helpers.HashedName(filename, hash))
+	asset, err := a.upload(key, tmp, size, contentType, hash, parent)
+	if err != nil {
+		return nil, fmt.Errorf("[assetStore.put]%w", err)
+	}
+	return asset, nil
+}
+
+// putCover stores a normalized cover like put, with its thumbnails next to it (see
+// helpers.ThumbKey) as assets accompanying the cover. Thumbnail failures are only
+// logged: the cover itself is what the record links to.
+//
+// Covers are never scaled up, so a small cover's thumbnails can have the same bytes
+// as the cover or each other, and a thumbnail can match an unrelated stored asset.
+// _assets holds one row per content hash, so those reuse the existing row and are
+// stored as untracked aliases: clients still find them by name, `gc` keeps them with
+// the cover (see isThumbAliasOf) and release deletes them along with it.
+func (a *assetStore) putCover(collection, filename string, cover helpers.NormalizedCover) (string, error) {
+	hash := sha1Hex(cover.Data)
+
+	existing, err := a.find("hash", hash)
+	if err != nil {
+		return "", fmt.Errorf("[assetStore.putCover]%w", err)
+	}
+	if existing != nil {
+		log.Printf("[assetStore.putCover]: '%s' matches stored '%s'.\n", filename, existing.GetString("key"))
+		return existing.GetString("url"), nil
+	}
+
+	key := helpers.ObjectKey(collection, helpers.HashedName(helpers.CoverFilename(filename, cover.MIME), hash))
+	asset, err := a.upload(key, bytes.NewReader(cover.Data), int64(len(cover.Data)), cover.MIME, hash, "")
+	if err != nil {
+		return "", fmt.Errorf("[assetStore.putCover]%w", err)
+	}
+	url := asset.GetString("url")
+
+	stored := map[string]bool{hash: true}
+	for name, data := range cover.Thumbs {
+		thumbKey, thumbHash := helpers.ThumbKey(key, name), sha1Hex(data)
+		if !stored[thumbHash] {
+			existing, err := a.find("hash", thumbHash)
+			if err != nil {
+				log.Printf("[assetStore.putCover] %s thumbnail: %v", name, err)
+				continue
+			}
+			stored[thumbHash] = existing != nil
+		}
+		if stored[thumbHash] {
+			if _, err := a.store.Put(thumbKey, bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+				log.Printf("[assetStore.putCover] %s thumbnail: %v", name, err)
+			}
+			continue
+		}
+		if _, err := a.upload(thumbKey, bytes.NewReader(data), int64(len(data)), "image/jpeg", thumbHash, url); err != nil {
+			log.Printf("[assetStore.putCover] %s thumbnail: %v", name, err)
+			continue
+		}
+		stored[thumbHash] = true
+	}
+
+	return url, nil
+}
+
+// upload puts r under key and records it in _assets. A concurrent upload of the same
+// content may record it first: when that row points at the same key, losing the race
+// on the unique hash index is harmless and its row is returned. Otherwise the object
+// would be left untracked (and deleted by `gc` while still linked), so it's removed
+// and the error returned.
+func (a *assetStore) upload(key string, r io.Reader, size int64, contentType, hash, parent string) (*core.Record, error) {
+	object, err := a.store.Put(key, r, size, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("[upload]%w", err)
+	}
+
+	assets, err := a.app.FindCollectionByNameOrId(assetsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("[upload][FindCollectionByNameOrId]: %w", err)
+	}
+	asset := core.NewRecord(assets)
+	asset.Set("hash", hash)
+	asset.Set("key", object.Key)
+	asset.Set("url", object.URL)
+	asset.Set("file_id", object.FileID)
+	asset.Set("parent", parent)
+	asset.Set("size", size)
+	asset.Set("content_type", contentType)
+	if err := a.app.Save(asset); err != nil {
+		existing, findErr := a.find("hash", hash)
+		if findErr == nil && existing != nil && existing.GetString("key") == object.Key {
+			log.Printf("[upload][save] %s: already recorded", object.Key)
+			return existing, nil
+		}
+		if delErr := a.store.Delete(object.Key); delErr != nil {
+			log.Printf("[upload][Delete] %s: %v", object.Key, delErr)
+		}
+		return nil, fmt.Errorf("[upload][save] %s: %w", object.Key, err)
+	}
+
+	return asset, nil
+}
+
+// sha1Hex returns the hex SHA-1 of data, the hash assets are keyed by.
+func sha1Hex(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// spool writes r to a temp file named after filename, for attaching to a file field of
+// the record. The file is read when the record is saved and removed afterwards (see
+// bindAssetHooks).
+func (a *assetStore) spool(recordID, filename string, r io.Reader) (*filesystem.File, error) {
+	dir, err := os.MkdirTemp("", "rivendell-file-*")
+	if err != nil {
+		return nil, fmt.Errorf("[spool][os.MkdirTemp]: %w", err)
+	}
+
+	a.spoolMu.Lock()
+	a.spooled[recordID] = append(a.spooled[recordID], dir)
+	a.spoolMu.Unlock()
+
+	tmp, err := os.Create(filepath.Join(dir, path.Base(filename)))
+	if err != nil {
+		return nil, fmt.Errorf("[spool][os.Create]: %w", err)
+	}
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return nil, fmt.Errorf("[spool][io.Copy]: %w", err)
+	}
+
+	file, err := filesystem.NewFileFromPath(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("[spool][NewFileFromPath]: %w", err)
+	}
+	return file, nil
+}
+
+// discardSpooled removes the temp files spooled for a record.
+func (a *assetStore) discardSpooled(recordID string) {
+	a.spoolMu.Lock()
+	dirs := a.spooled[recordID]
+	delete(a.spooled, recordID)
+	a.spoolMu.Unlock()
+
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("[discardSpooled] %s: %v", dir, err)
+		}
+	}
+}
+
+// release deletes the asset stored at url, and any assets accompanying it, once no
+// record references it anymore. URLs that weren't stored through put are ignored.
+func (a *assetStore) release(url string) error {
+	if url == "" {
+		return nil
+	}
+
+	asset, err := a.find("url", url)
+	if err != nil || asset == nil {
+		return err
+	}
+
+	inUse, err := a.referenced(url)
+	if err != nil || inUse {
+		return err
+	}
+
+	children, err := a.app.FindRecordsByFilter(assetsCollection, "parent = {:url} || owners ~ {:url}", "", 0, 0, dbx.Params{"url": url})
+	if err != nil {
+		return fmt.Errorf("[release][FindRecordsByFilter]: %w", err)
+	}
+	for _, child := range children {
+		if err := a.disown(child, url); err != nil {
+			return fmt.Errorf("[release]%w", err)
+		}
+	}
+	if err := a.removeThumbAliases(asset); err != nil {
+		return fmt.Errorf("[release]%w", err)
+	}
+	if err := a.remove(asset); err != nil {
+		return fmt.Errorf("[release]%w", err)
+	}
+	return nil
+}
+
+// removeThumbAliases deletes a cover's untracked thumbnail aliases (see putCover).
+func (a *assetStore) removeThumbAliases(asset *core.Record) error {
+	if asset.GetString("parent") != "" || !strings.HasPrefix(asset.GetString("content_type"), "image/") {
+		return nil
+	}
+	for name := range helpers.CoverThumbs {
+		key := helpers.ThumbKey(asset.GetString("key"), name)
+		tracked, err := a.find("key", key)
+		if err != nil {
+			return fmt.Errorf("[removeThumbAliases]%w", err)
+		}
+		if tracked != nil {
+			continue // an accompanying asset, already released
+		}
+		exists, err := a.store.Exists(key)
+		if err != nil {
+			return fmt.Errorf("[removeThumbAliases][Exists] %s: %w", key, err)
+		}
+		if !exists {
+			continue
+		}
+		if err := a.store.Delete(key); err != nil {
+			return fmt.Errorf("[removeThumbAliases][Delete] %s: %w", key, err)
+		}
+		log.Printf("[removeThumbAliases]: Deleted '%s'.\n", key)
+	}
+	return nil
+}
+
+// disown detaches an asset from the released asset at url: one shared with other
+// archives (see adopt) passes to the next of its owners, one a record still links to
+// (e.g. from its `archives`) is kept on its own, anything else is deleted.
+func (a *assetStore) disown(asset *core.Record, url string) error {
+	owners := slices.DeleteFunc(assetOwners(asset), func(owner string) bool { return owner == url })
+	if asset.GetString("parent") == url {
+		if len(owners) > 0 {
+			asset.Set("parent", owners[0])
+			owners = owners[1:]
+		} else if inUse, err := a.referenced(asset.GetString("url")); err != nil {
+			return fmt.Errorf("[disown]%w", err)
+		} else if !inUse {
+			return a.remove(asset)
+		} else {
+			asset.Set("parent", "")
+		}
+	}
+
+	asset.Set("owners", owners)
+	if err := a.app.Save(asset); err != nil {
+		return fmt.Errorf("[disown][save] %s: %w", asset.GetString("key"), err)
+	}
+	return nil
+}
+
+// referenced reports whether any record still links to url, from an asset field or
+// one of its `archives` entries.
+func (a *assetStore) referenced(url string) (bool, error) {
+	for collection, fields := range assetFields {
+		c, err := a.app.FindCachedCollectionByNameOrId(collection)
+		if err != nil {
+			continue
+		}
+
+		conditions := make([]string, len(fields))
+		for i, field := range fields {
+			conditions[i] = field + " = {:url}"
+		}
+		if c.Fields.GetByName("archives") != nil {
+			conditions = append(conditions, "archives ~ {:url}")
+		}
+		records, err := a.app.FindRecordsByFilter(collection, strings.Join(conditions, " || "), "", 1, 0, dbx.Params{"url": url})
+		if err != nil {
+			return false, fmt.Errorf("[referenced][FindRecordsByFilter] %s: %w", collection, err)
+		}
+		if len(records) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// remove deletes an asset's object from storage, then its _assets record.
+func (a *assetStore) remove(asset *core.Record) error {
+	key := asset.GetString("key")
+
+	var err error
+	if deleter, ok := a.store.(versionDeleter); ok && asset.GetString("file_id") != "" {
+		err = deleter.DeleteVersion(key, asset.GetString("file_id"))
+	} else {
+		err = a.store.Delete(key)
+	}
+	if err != nil {
+		return fmt.Errorf("[remove] %s: %w", key, err)
+	}
+
+	if err := a.app.Delete(asset); err != nil {
+		return fmt.Errorf("[remove][delete] %s: %w", key, err)
+	}
+	log.Printf("[remove]: Deleted '%s'.\n", key)
+	return nil
+}
+
+// keyFor returns the storage key behind url: the one recorded in _assets, or for
+// uploads that predate it, the key the backend's public URL was built from. Returns ""
+// for URLs that don't point into storage.
+func (a *assetStore) keyFor(url string) (string, error) {
+	asset, err := a.find("url", url)
+	if err != nil {
+		return "", fmt.Errorf("[keyFor]%w", err)
+	}
+	if asset != nil {
+		return asset.GetString("key"), nil
+	}
+
+	escaped, ok := strings.CutPrefix(url, a.store.PublicURL(""))
+	if !ok {
+		return "", nil
+	}
+	key, err := neturl.PathUnescape(escaped)
+	if err != nil {
+		return "", fmt.Errorf("[keyFor][PathUnescape]: %w", err)
+	}
+	return key, nil
+}
+
+// downloadURL returns where to download the asset stored at url. On a private backend
+// that's a short-lived signed URL; otherwise url itself.
+func (a *assetStore) downloadURL(url string) (string, error) {
+	signer, ok := a.store.(helpers.Signer)
+	if !ok || !signer.Private() {
+		return url, nil
+	}
+
+	key, err := a.keyFor(url)
+	if err != nil {
+		return "", fmt.Errorf("[downloadURL]%w", err)
+	}
+	if key == "" {
+		return url, nil
+	}
+
+	signed, err := signer.SignedURL(key, signedURLTTL)
+	if err != nil {
+		return "", fmt.Errorf("[downloadURL]%w", err)
+	}
+	return signed, nil
+}
+
+// serveAsset handles GET /api/rivendell/archive/{collection}/{id}/{field}: it checks the
+// record's view rule like the records API does, then redirects to a download URL for
+// the asset in field. On bookmarks, field can also be an archive artifact kind (e.g.
+// "warc"), served from the `archives` list. Records the caller can't view are reported
+// as not found.
+func serveAsset(assets *assetStore) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		collection := e.Request.PathValue("collection")
+		field := e.Request.PathValue("field")
+		isArtifact := !slices.Contains(assetFields[collection], field)
+		if isArtifact && collection != "bookmarks" {
+			return e.NotFoundError("", nil)
+		}
+
+		record, err := e.App.FindRecordById(collection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("", err)
+		}
+
+		info, err := e.RequestInfo()
+		if err != nil {
+			return e.BadRequestError("", err)
+		}
+		canView, err := e.App.CanAccessRecord(record, info, record.Collection().ViewRule)
+		if !canView {
+			return e.NotFoundError("", err)
+		}
+
+		url := record.GetString(field)
+		if isArtifact {
+			url = ""
+			if a := findArtifact(recordArtifacts(record), field); a != nil && a.Status == artifactOK {
+				url = a.URL
+			}
+		}
+		if url == "" {
+			return e.NotFoundError("", nil)
+		}
+
+		target, err := assets.downloadURL(url)
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+
+		e.Response.Header().Set("Cache-Control", "private, no-store")
+		return e.Redirect(http.StatusTemporaryRedirect, target)
+	}
+}
+
+// bindAssetHooks serves the archive download route, and releases a record's assets
+// when it's deleted and the previous asset when an update replaces one (e.g. a
+// re-enriched cover). Release failures are only logged: the record change has
+// already been committed, and `gc` sweeps up anything left behind.
+// Files spooled for a record are removed once its update is saved or fails.
+func bindAssetHooks(app core.App, assets *assetStore) {
+	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		e.Router.GET("/api/rivendell/archive/{collection}/{id}/{field}", serveAsset(assets))
+		return e.Next()
+	})
+
+	collections := make([]string, 0, len(assetFields))
+	for collection := range assetFields {
+		collections = append(collections, collection)
+	}
+
+	app.OnRecordAfterDeleteSuccess(collections...).BindFunc(func(e *core.RecordEvent) error {
+		for _, field := range assetFields[e.Record.Collection().Name] {
+			if err := assets.release(e.Record.GetString(field)); err != nil {
+				log.Printf("[OnRecordAfterDeleteSuccess] %s/%s %s: %v", e.Record.Collection().Name, e.Record.Id, field, err)
+			}
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateError(collections...).BindFunc(func(e *core.RecordErrorEvent) error {
+		assets.discardSpooled(e.Record.Id)
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess(collections...).BindFunc(func(e *core.RecordEvent) error {
+		assets.discardSpooled(e.Record.Id)
+
+		for _, field := range assetFields[e.Record.Collection().Name] {
+			previous := e.Record.Original().GetString(field)
+			if previous == e.Record.GetString(field) {
+				continue
+			}
+			if err := assets.release(previous); err != nil {
+				log.Printf("[OnRecordAfterUpdateSuccess] %s/%s %s: %v", e.Record.Collection().Name, e.Record.Id, field, err)
+			}
+		}
+		return e.Next()
+	})
+}
+
+// adopt makes the assets at urls accompany archive, so they're deleted along with it
+// (e.g. the images mirrored for an article). previous is the archive it replaces:
+// assets accompanying that one move over, as it's released once replaced. An asset
+// already accompanying another article's archive (the same image in two articles) is
+// shared: archive is added to its owners, which keep it alive (see release). Assets a
+// record links to directly, or that accompany something other than an article
+// archive (a cover's thumbnails), are left alone.
+func (a *assetStore) adopt(urls []string, archive, previous string) error {
+	for _, url := range urls {
+		asset, err := a.find("url", url)
+		if err != nil {
+			return fmt.Errorf("[adopt]%w", err)
+		}
+		if asset == nil || asset.GetString("parent") == archive {
+			continue
+		}
+
+		switch current := asset.GetString("parent"); {
+		case current == "":
+			inUse, err := a.referenced(url)
+			if err != nil {
+				return fmt.Errorf("[adopt]%w", err)
+			}
+			if inUse {
+				continue
+			}
+			asset.Set("parent", archive)
+		case current == previous:
+			asset.Set("parent", archive)
+		default:
+			owner, err := a.find("url", current)
+			if err != nil {
+				return fmt.Errorf("[adopt]%w", err)
+			}
+			owners := assetOwners(asset)
+			if owner == nil || owner.GetString("content_type") != "text/markdown" || slices.Contains(owners, archive) {
+				continue
+			}
+			asset.Set("owners", append(owners, archive))
+		}
+
+		if err := a.app.Save(asset); err != nil {
+			return fmt.Errorf("[adopt][save] %s: %w", asset.GetString("key"), err)
+		}
+	}
+	return nil
+}
+
+// assetOwners reads the archives besides its parent that an asset accompanies.
+func assetOwners(asset *core.Record) []string {
+	if asset.GetString("owners") == "" {
+		return nil
+	}
+	var owners []string
+	if err := asset.UnmarshalJSONField("owners", &owners); err != nil {
+		return nil
+	}
+	return owners
+}
+
+// find returns the _assets record whose field ("hash", "url" or "key") equals value, or nil
+// when there's none.
+func (a *assetStore) find(field, value string) (*core.Record, error) {
+	records, err := a.app.FindRecordsByFilter(assetsCollection, field+" = {:value}", "", 1, 0, dbx.Params{"value": value})
+	if err != nil {
+		return nil, fmt.Errorf("[find][FindRecordsByFilter]: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
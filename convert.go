@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	neturl "net/url"
+	"path"
+	"sort"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// open reads the asset stored at url: through the storage backend when it's one of
+// ours (so private buckets work), otherwise over HTTP. Also returns a file name for it.
+func (a *assetStore) open(url string) (io.ReadCloser, string, error) {
+	key, err := a.keyFor(url)
+	if err != nil {
+		return nil, "", fmt.Errorf("[open]%w", err)
+	}
+	if key != "" {
+		body, err := a.store.Open(key)
+		if err != nil {
+			return nil, "", fmt.Errorf("[open]%w", err)
+		}
+		return body, path.Base(key), nil
+	}
+
+	body, err := fetchCover(url)
+	if err != nil {
+		return nil, "", fmt.Errorf("[open]%w", err)
+	}
+	name := "file"
+	if parsed, err := neturl.Parse(url); err == nil && path.Base(parsed.Path) != "/" {
+		name = path.Base(parsed.Path)
+	}
+	return body, name, nil
+}
+
+// archiveSnapshots maps the file fields holding an article's snapshots to the content
+// type they're stored under as assets accompanying the archive.
+var archiveSnapshots = map[string]string{
+	"snapshot_file": "text/html",
+	"warc_file":     warcContentType,
+}
+
+// needsConversion reports whether any of the record's asset URL fields has no file yet.
+func needsConversion(r *core.Record) bool {
+	for _, field := range assetFields[r.Collection().Name] {
+		if r.GetString(field) != "" && r.GetString(field+"_file") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// convertRecord attaches the assets linked from a record's URL fields to the matching
+// file fields (e.g. cover → cover_file), including an article's SingleFile and WARC
+// snapshots.
+// With clearURLs set, the URL fields are emptied, which releases the stored objects.
+// Reports whether anything changed.
+func convertRecord(assets *assetStore, r *core.Record, clearURLs bool) (bool, error) {
+	var changed bool
+	attached := map[string]string{} // file field → attached file name
+
+	attach := func(field, url string) error {
+		body, name, err := assets.open(url)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		file, err := assets.spool(r.Id, name, body)
+		if err != nil {
+			return err
+		}
+		r.Set(field, file)
+		attached[field] = file.Name
+		changed = true
+		return nil
+	}
+
+	for _, field := range assetFields[r.Collection().Name] {
+		url := r.GetString(field)
+		if url == "" {
+			continue
+		}
+
+		if r.GetString(field+"_file") == "" {
+			if err := attach(field+"_file", url); err != nil {
+				return false, fmt.Errorf("[convertRecord] %s: %w", field, err)
+			}
+		}
+
+		for snapshotField, contentType := range archiveSnapshots {
+			if field != "archive" || r.GetString(snapshotField) != "" {
+				continue
+			}
+			snapshots, err := assets.app.FindRecordsByFilter(
+				assetsCollection,
+				"parent = {:url} && content_type = {:type}",
+				"", 1, 0,
+				dbx.Params{"url": url, "type": contentType},
+			)
+			if err != nil {
+				return false, fmt.Errorf("[convertRecord][FindRecordsByFilter]: %w", err)
+			}
+			if len(snapshots) > 0 {
+				if err := attach(snapshotField, snapshots[0].GetString("url")); err != nil {
+					return false, fmt.Errorf("[convertRecord] %s: %w", snapshotField, err)
+				}
+			}
+		}
+
+		if clearURLs {
+			r.Set(field, "")
+			changed = true
+		}
+	}
+
+	if len(attached) > 0 && r.Collection().Fields.GetByName("archives") != nil {
+		r.Set("archives", convertArtifacts(recordArtifacts(r), attached, clearURLs))
+	}
+
+	return changed, nil
+}
+
+// convertArtifacts points a bookmark's archive artifacts at the files convertRecord
+// attached; with clearURLs their URLs are dropped, as the objects are released.
+func convertArtifacts(artifacts []archiveArtifact, attached map[string]string, clearURLs bool) []archiveArtifact {
+	for i, a := range artifacts {
+		name, ok := attached[archiveFileFields[a.Kind]]
+		if !ok || a.Status != artifactOK {
+			continue
+		}
+		artifacts[i].Field = archiveFileFields[a.Kind]
+		artifacts[i].File = name
+		if clearURLs {
+			artifacts[i].URL = ""
+		}
+	}
+	return artifacts
+}
+
+// assetCollections lists the collections with asset fields, sorted.
+func assetCollections() []string {
+	collections := make([]string, 0, len(assetFields))
+	for collection := range assetFields {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	return collections
+}
+
+// convertCollections converts the records of the given collections, logging each
+// record that fails and carrying on with the rest. With dryRun set, records that
+// need converting are only listed. Reports how many records were converted and how
+// many failed.
+func convertCollections(app core.App, assets *assetStore, collections []string, dryRun, clearURLs bool) (converted, failed int, err error) {
+	for _, collection := range collections {
+		if _, ok := assetFields[collection]; !ok {
+			return converted, failed, fmt.Errorf("[convertCollections]: no asset fields in %q", collection)
+		}
+
+		records, err := app.FindAllRecords(collection)
+		if err != nil {
+			return converted, failed, fmt.Errorf("[convertCollections][FindAllRecords] %s: %w", collection, err)
+		}
+
+		for _, r := range records {
+			if dryRun {
+				if needsConversion(r) {
+					log.Printf("[convert-assets] would convert %s/%s", collection, r.Id)
+				}
+				continue
+			}
+
+			saved, err := applyEnricher(app, func(r *core.Record) (bool, error) {
+				return convertRecord(assets, r, clearURLs)
+			}, r)
+			if err != nil {
+				assets.discardSpooled(r.Id)
+				failed++
+				log.Printf("[convert-assets] %s/%s: %v", collection, r.Id, err)
+				continue
+			}
+			if saved {
+				converted++
+				log.Printf("[convert-assets] %s/%s: converted", collection, r.Id)
+			}
+		}
+	}
+	return converted, failed, nil
+}
+
+// convertOnMigrate returns the conversion run by the convert_assets_to_files
+// migration: with ASSET_STORAGE=file, every record's linked assets are attached to
+// its file fields. URLs are kept, and records that fail are only logged so one
+// unreachable asset doesn't keep the server from starting; `convert-assets` retries them.
+func convertOnMigrate(assets *assetStore) func(core.App) error {
+	return func(app core.App) error {
+		if !assets.files {
+			return nil
+		}
+
+		// Like the migration adding the file fields, skip collections that don't exist.
+		var collections []string
+		for _, name := range assetCollections() {
+			_, err := app.FindCollectionByNameOrId(name)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("[convertOnMigrate][FindCollectionByNameOrId]: %w", err)
+			}
+			collections = append(collections, name)
+		}
+
+		converted, failed, err := convertCollections(app, assets, collections, false, false)
+		if err != nil {
+			return fmt.Errorf("[convertOnMigrate]%w", err)
+		}
+		log.Printf("[convert-assets] %d converted, %d failed", converted, failed)
+		return nil
+	}
+}
+
+// newConvertAssetsCmd builds the `convert-assets` command, which moves existing
+// records over to file fields after switching to ASSET_STORAGE=file.
+func newConvertAssetsCmd(app core.App, assets *assetStore) *cobra.Command {
+	var (
+		dryRun    bool
+		clearURLs bool
+	)
+
+	collections := assetCollections()
+
+	cmd := &cobra.Command{
+		Use:          "convert-assets [collection...]",
+		Short:        "Attach archives and covers linked by URL to the records' file fields",
+		Long:         fmt.Sprintf("Attach archives and covers linked by URL to the records' file fields.\n\nThe convert_assets_to_files migration does this once on upgrade when ASSET_STORAGE=file; run this after switching to file storage later, to retry records that failed, or to --clear the URLs.\n\nCollections (default: all): %v", collections),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			selected := collections
+			if len(args) > 0 {
+				selected = args
+			}
+
+			converted, failed, err := convertCollections(app, assets, selected, dryRun, clearURLs)
+			if err != nil {
+				return fmt.Errorf("[convert-assets]%w", err)
+			}
+			log.Printf("[convert-assets] %d converted, %d failed", converted, failed)
+			if failed > 0 {
+				return fmt.Errorf("[convert-assets]: %d records failed", failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list records with linked assets without downloading anything")
+	cmd.Flags().BoolVar(&clearURLs, "clear", false, "empty the URL fields once converted, deleting objects no other record links to")
+
+	return cmd
+}
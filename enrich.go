@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// errNoMatch is returned by an Enricher that can't look a record up (e.g. a book
+// without an ISBN). The registry moves on to the next enricher without treating it
+// as a failure.
+var errNoMatch = errors.New("no match")
+
+// Asset is a remote file to mirror into storage. Once uploaded, Field is set to the
+// mirrored URL; with ASSET_STORAGE=file the file is attached to Field+"_file" instead.
+type Asset struct {
+	Field    string // record field receiving the mirrored URL (e.g. "cover")
+	URL      string // source URL from the provider
+	Filename string // path within the collection's storage folder
+}
+
+// Patch is what an Enricher found for a record. Zero values (a 0 Year, nil or empty
+// Fields entries, assets without a URL) are left untouched, so a provider missing a
+// field never blanks what the record already has.
+type Patch struct {
+	Year   int
+	Fields map[string]any
+	Assets []Asset
+}
+
+// Enricher looks a record up in one external source.
+type Enricher interface {
+	// Name identifies the source in logs and errors (e.g. "openlibrary").
+	Name() string
+	Lookup(r *core.Record) (Patch, error)
+}
+
+// Registry maps collections to their enrichers. Enrichers registered for the same
+// collection form a fallback chain: the first one to return a patch wins. Patch
+// assets are mirrored through assets.
+type Registry struct {
+	chains map[string][]Enricher
+	assets *assetStore
+}
+
+func newRegistry(assets *assetStore) *Registry {
+	return &Registry{chains: map[string][]Enricher{}, assets: assets}
+}
+
+// Register appends enrichers to the collection's chain, in fallback order.
+func (reg *Registry) Register(collection string, enrichers ...Enricher) {
+	reg.chains[collection] = append(reg.chains[collection], enrichers...)
+}
+
+// Has reports whether any enricher is registered for the collection.
+func (reg *Registry) Has(collection string) bool {
+	return len(reg.chains[collection]) > 0
+}
+
+// Collections returns the registered collection names, sorted.
+func (reg *Registry) Collections() []string {
+	names := make([]string, 0, len(reg.chains))
+	for name := range reg.chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enrich runs the record's chain and applies the first successful patch. An empty
+// patch counts as no match, so the next enricher gets a chance.
+// Reports whether any field changed. When every enricher fails, the errors are
+// joined so the job queue can still find a retryable provider error among them.
+func (reg *Registry) Enrich(r *core.Record) (bool, error) {
+	collection := r.Collection().Name
+	chain := reg.chains[collection]
+	if len(chain) == 0 {
+		return false, fmt.Errorf("[Enrich]: no enricher for %q", collection)
+	}
+
+	var errs []error
+	for _, enricher := range chain {
+		patch, err := enricher.Lookup(r)
+		if errors.Is(err, errNoMatch) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("[Enrich][%s]: %w", enricher.Name(), err))
+			continue
+		}
+		if patch.empty() {
+			continue // found nothing to write: treated like errNoMatch
+		}
+		changed, err := applyPatch(reg.assets, r, patch)
+		if err != nil {
+			// The record won't be saved, so nothing will read files spooled for it.
+			reg.assets.discardSpooled(r.Id)
+		}
+		return changed, err
+	}
+
+	return false, errors.Join(errs...)
+}
+
+// empty reports whether applyPatch would leave the record untouched.
+func (p Patch) empty() bool {
+	if p.Year != 0 {
+		return false
+	}
+	for _, value := range p.Fields {
+		if value != nil && !reflect.ValueOf(value).IsZero() {
+			return false
+		}
+	}
+	for _, asset := range p.Assets {
+		if asset.URL != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// applyPatch writes a patch to the record, mirroring its assets to storage first.
+func applyPatch(assets *assetStore, r *core.Record, patch Patch) (bool, error) {
+	var changed bool
+
+	if patch.Year != 0 {
+		r.Set("year", patch.Year)
+		changed = true
+	}
+
+	for field, value := range patch.Fields {
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			continue
+		}
+		r.Set(field, value)
+		changed = true
+	}
+
+	for _, asset := range patch.Assets {
+		if asset.URL == "" {
+			continue
+		}
+		if assets.files {
+			file, err := attachCover(assets, r.Id, asset.URL, asset.Filename)
+			if err != nil {
+				return false, fmt.Errorf("[applyPatch] %s: %w", asset.Field, err)
+			}
+			r.Set(asset.Field+"_file", file)
+		} else {
+			url, err := uploadCover(assets, asset.URL, r.Collection().Name, asset.Filename)
+			if err != nil {
+				return false, fmt.Errorf("[applyPatch] %s: %w", asset.Field, err)
+			}
+			r.Set(asset.Field, url)
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// parseYear converts a provider's string year (e.g. "1999") to an int; 0 when unknown.
+func parseYear(year string) int {
+	y, err := strconv.Atoi(year)
+	if err != nil {
+		return 0
+	}
+	return y
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fourjuaneight/rivendell/helpers"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// extractionRulesCollection holds the per-site rules articles are extracted with.
+const extractionRulesCollection = "_extraction_rules"
+
+// extractionRule reads one _extraction_rules record.
+func extractionRule(r *core.Record) (helpers.ExtractionRule, error) {
+	rule := helpers.ExtractionRule{Host: r.GetString("host"), KeepImages: r.GetBool("keep_images")}
+	for field, target := range map[string]any{"remove": &rule.Remove, "keep": &rule.Keep, "replace": &rule.Replace} {
+		if r.GetString(field) == "" {
+			continue
+		}
+		if err := r.UnmarshalJSONField(field, target); err != nil {
+			return rule, fmt.Errorf("[extractionRule] %s: %w", field, err)
+		}
+	}
+	return rule, nil
+}
+
+// extractionRules loads every site rule. They're read for each archived article, so
+// edits in the admin UI apply without a restart. A missing collection means no rules.
+func extractionRules(app core.App) ([]helpers.ExtractionRule, error) {
+	if _, err := app.FindCachedCollectionByNameOrId(extractionRulesCollection); err != nil {
+		return nil, nil
+	}
+	records, err := app.FindAllRecords(extractionRulesCollection)
+	if err != nil {
+		return nil, fmt.Errorf("[extractionRules][FindAllRecords]: %w", err)
+	}
+
+	rules := make([]helpers.ExtractionRule, 0, len(records))
+	for _, r := range records {
+		rule, err := extractionRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("[extractionRules] %s: %w", r.GetString("host"), err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// bindExtractionRuleHooks rejects rules whose selectors or patterns don't compile,
+// with a field error, instead of letting them fail (or silently match nothing) when
+// an article is archived.
+func bindExtractionRuleHooks(app core.App) {
+	app.OnRecordValidate(extractionRulesCollection).BindFunc(func(e *core.RecordEvent) error {
+		rule, err := extractionRule(e.Record)
+		if err != nil {
+			return err
+		}
+
+		errs := validation.Errors{}
+		if err := helpers.CheckSelectors(rule.Remove); err != nil {
+			errs["remove"] = validation.NewError("validation_invalid_selector", err.Error())
+		}
+		if err := helpers.CheckSelectors(rule.Keep); err != nil {
+			errs["keep"] = validation.NewError("validation_invalid_selector", err.Error())
+		}
+		if err := helpers.CheckReplacements(rule.Replace); err != nil {
+			errs["replace"] = validation.NewError("validation_invalid_pattern", err.Error())
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+
+		return e.Next()
+	})
+}
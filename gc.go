@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/fourjuaneight/rivendell/helpers"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// gcPrefix is the part of the bucket the app owns; nothing outside it is touched.
+const gcPrefix = "PocketBase/"
+
+// gcReport is what a `gc` run found.
+type gcReport struct {
+	Objects int      // objects listed under gcPrefix
+	Orphans []string // keys no record references
+	Missing []string // _assets keys whose object is gone from storage
+}
+
+// collectGarbage reconciles storage against the records referencing it. Objects are
+// live when a record links to them (see assetFields and `archives`). A tracked asset
+// is also live while a record links to the asset it accompanies, or to one of the
+// archives sharing it (see adopt). Objects uploaded before _assets existed are
+// matched by their public URL, and their SingleFile snapshots by the article's `.md`
+// next to them. Untracked thumbnail aliases are live with their cover.
+// With remove set, orphans are deleted along with their _assets records, and
+// records for missing objects are dropped so they're no longer reused.
+func collectGarbage(app core.App, assets *assetStore, remove bool) (gcReport, error) {
+	var report gcReport
+
+	keys, err := assets.store.List(gcPrefix)
+	if err != nil {
+		return report, fmt.Errorf("[collectGarbage]%w", err)
+	}
+	report.Objects = len(keys)
+
+	refs := map[string]bool{}
+	for collection, fields := range assetFields {
+		if _, err := app.FindCachedCollectionByNameOrId(collection); err != nil {
+			continue
+		}
+		records, err := app.FindAllRecords(collection)
+		if err != nil {
+			return report, fmt.Errorf("[collectGarbage][FindAllRecords] %s: %w", collection, err)
+		}
+		for _, r := range records {
+			for _, field := range fields {
+				if url := r.GetString(field); url != "" {
+					refs[url] = true
+				}
+			}
+			for _, artifact := range recordArtifacts(r) {
+				if artifact.URL != "" {
+					refs[artifact.URL] = true
+				}
+			}
+		}
+	}
+
+	tracked, err := app.FindAllRecords(assetsCollection)
+	if err != nil {
+		return report, fmt.Errorf("[collectGarbage][FindAllRecords]: %w", err)
+	}
+	byKey := make(map[string]*core.Record, len(tracked))
+	for _, asset := range tracked {
+		byKey[asset.GetString("key")] = asset
+	}
+
+	stored := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		stored[key] = true
+
+		if asset, ok := byKey[key]; ok {
+			if refs[asset.GetString("url")] || refs[asset.GetString("parent")] || slices.ContainsFunc(assetOwners(asset), func(owner string) bool { return refs[owner] }) {
+				continue
+			}
+		} else if refs[assets.store.PublicURL(key)] || isLegacySnapshotOf(key, refs, assets.store.PublicURL) || isThumbAliasOf(key, byKey, refs) {
+			continue
+		}
+		report.Orphans = append(report.Orphans, key)
+	}
+
+	for key := range byKey {
+		if !stored[key] {
+			report.Missing = append(report.Missing, key)
+		}
+	}
+
+	if !remove {
+		return report, nil
+	}
+
+	for _, key := range report.Orphans {
+		if asset, ok := byKey[key]; ok {
+			err = assets.remove(asset)
+		} else {
+			err = assets.store.Delete(key)
+		}
+		if err != nil {
+			return report, fmt.Errorf("[collectGarbage]%w", err)
+		}
+	}
+	for _, key := range report.Missing {
+		if err := app.Delete(byKey[key]); err != nil {
+			return report, fmt.Errorf("[collectGarbage][delete] %s: %w", key, err)
+		}
+	}
+
+	return report, nil
+}
+
+// isLegacySnapshotOf reports whether key is an untracked SingleFile snapshot whose
+// article archive (same path, `.md`) is still referenced.
+func isLegacySnapshotOf(key string, refs map[string]bool, publicURL func(string) string) bool {
+	if !strings.HasPrefix(key, gcPrefix+"Bookmarks/Articles/") || !strings.HasSuffix(key, ".html") {
+		return false
+	}
+	return refs[publicURL(strings.TrimSuffix(key, ".html")+".md")]
+}
+
+// isThumbAliasOf reports whether key is an untracked thumbnail alias (see putCover) of
+// a tracked cover that's still referenced.
+func isThumbAliasOf(key string, byKey map[string]*core.Record, refs map[string]bool) bool {
+	ext := path.Ext(key)
+	for name := range helpers.CoverThumbs {
+		base, ok := strings.CutSuffix(strings.TrimSuffix(key, ext), "-"+name)
+		if !ok {
+			continue
+		}
+		if cover, ok := byKey[base+ext]; ok && refs[cover.GetString("url")] {
+			return true
+		}
+	}
+	return false
+}
+
+// newGCCmd builds the `gc` command, which reports objects under PocketBase/ that no
+// record references and, with --delete, removes them.
+func newGCCmd(app core.App, assets *assetStore) *cobra.Command {
+	var remove bool
+
+	cmd := &cobra.Command{
+		Use:          "gc",
+		Short:        "Report (or delete) stored archives and covers no record references",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := collectGarbage(app, assets, remove)
+			if err != nil {
+				return err
+			}
+
+			verb := "orphaned"
+			if remove {
+				verb = "deleted"
+			}
+			for _, key := range report.Orphans {
+				log.Printf("[gc] %s %s", verb, key)
+			}
+			for _, key := range report.Missing {
+				log.Printf("[gc] missing from storage: %s", key)
+			}
+
+			log.Printf(
+				"[gc] %d objects, %d live, %d %s, %d tracked but missing",
+				report.Objects, report.Objects-len(report.Orphans), len(report.Orphans), verb, len(report.Missing),
+			)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&remove, "delete", false, "delete orphaned objects instead of only listing them")
+
+	return cmd
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/fourjuaneight/rivendell/helpers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// assetChecksCollection holds the assets the health check found broken.
+const assetChecksCollection = "_asset_checks"
+
+const (
+	// defaultAssetCheckSchedule runs the health check on Sundays at 04:00.
+	defaultAssetCheckSchedule = "0 4 * * 0"
+	assetCheckConcurrency     = 4
+)
+
+// assetCheck is the result of checking the asset linked from one record field.
+type assetCheck struct {
+	Collection string
+	Record     string
+	Field      string
+	URL        string
+	Status     int   // HTTP status (404 for objects gone from storage); 0 when the request failed
+	Err        error // nil when the asset can still be downloaded
+}
+
+// healthReport is what a health check run found.
+type healthReport struct {
+	Checked int
+	Broken  []assetCheck
+}
+
+// probe checks that the asset at url can still be downloaded: through the storage
+// backend when it's one of ours (so private buckets work), otherwise like a link
+// (see probeLink).
+func (a *assetStore) probe(url string) (int, error) {
+	key, err := a.keyFor(url)
+	if err != nil {
+		return 0, fmt.Errorf("[probe]%w", err)
+	}
+	if key != "" {
+		ok, err := a.store.Exists(key)
+		if err != nil {
+			return 0, fmt.Errorf("[probe]%w", err)
+		}
+		if !ok {
+			return http.StatusNotFound, fmt.Errorf("[probe]: %w: %s", helpers.ErrObjectNotFound, key)
+		}
+		return http.StatusOK, nil
+	}
+
+	status, err := probeLink(url)
+	if err != nil {
+		return 0, fmt.Errorf("[probe]%w", err)
+	}
+	if status >= http.StatusBadRequest {
+		return status, fmt.Errorf("[probe]: %d %s", status, http.StatusText(status))
+	}
+	return status, nil
+}
+
+// checkAssets probes every archive and cover URL stored in the asset fields (see
+// assetFields) and records the broken ones in _asset_checks, counting consecutive
+// failures. Rows for assets that are reachable again, or no longer linked, are
+// removed. A tracked object that's gone from storage also loses its _assets record,
+// so re-archiving it uploads the content again instead of reusing the dead URL.
+// Files attached to file fields live in PocketBase's own storage and aren't checked.
+func checkAssets(app core.App, assets *assetStore) (healthReport, error) {
+	var (
+		report healthReport
+		checks []assetCheck
+	)
+
+	collections := make([]string, 0, len(assetFields))
+	for collection := range assetFields {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		if _, err := app.FindCachedCollectionByNameOrId(collection); err != nil {
+			continue
+		}
+		records, err := app.FindAllRecords(collection)
+		if err != nil {
+			return report, fmt.Errorf("[checkAssets][FindAllRecords] %s: %w", collection, err)
+		}
+		for _, r := range records {
+			for _, field := range assetFields[collection] {
+				if url := r.GetString(field); url != "" {
+					checks = append(checks, assetCheck{Collection: collection, Record: r.Id, Field: field, URL: url})
+				}
+			}
+		}
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, assetCheckConcurrency)
+	)
+	for i := range checks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c *assetCheck) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			c.Status, c.Err = assets.probe(c.URL)
+		}(&checks[i])
+	}
+	wg.Wait()
+
+	existing, err := app.FindAllRecords(assetChecksCollection)
+	if err != nil {
+		return report, fmt.Errorf("[checkAssets][FindAllRecords]: %w", err)
+	}
+	rows := make(map[string]*core.Record, len(existing))
+	for _, row := range existing {
+		rows[row.GetString("collection")+"/"+row.GetString("record")+"/"+row.GetString("field")] = row
+	}
+
+	for _, c := range checks {
+		id := c.Collection + "/" + c.Record + "/" + c.Field
+		row := rows[id]
+		delete(rows, id)
+
+		if c.Err == nil {
+			if row != nil {
+				if err := app.Delete(row); err != nil {
+					return report, fmt.Errorf("[checkAssets][delete] %s: %w", id, err)
+				}
+			}
+			continue
+		}
+
+		if err := recordBrokenAsset(app, assets, row, c); err != nil {
+			return report, fmt.Errorf("[checkAssets]%w", err)
+		}
+		report.Broken = append(report.Broken, c)
+	}
+
+	// Whatever's left belongs to deleted records or emptied fields.
+	for id, row := range rows {
+		if err := app.Delete(row); err != nil {
+			return report, fmt.Errorf("[checkAssets][delete] %s: %w", id, err)
+		}
+	}
+
+	report.Checked = len(checks)
+	return report, nil
+}
+
+// recordBrokenAsset saves a failed check to _asset_checks, into row when the field
+// was already broken. Failures keep counting only while the URL stays the same.
+func recordBrokenAsset(app core.App, assets *assetStore, row *core.Record, c assetCheck) error {
+	failures := 1
+	if row == nil {
+		collection, err := app.FindCollectionByNameOrId(assetChecksCollection)
+		if err != nil {
+			return fmt.Errorf("[recordBrokenAsset][FindCollectionByNameOrId]: %w", err)
+		}
+		row = core.NewRecord(collection)
+	} else if row.GetString("url") == c.URL {
+		failures = row.GetInt("failures") + 1
+	}
+
+	row.Set("collection", c.Collection)
+	row.Set("record", c.Record)
+	row.Set("field", c.Field)
+	row.Set("url", c.URL)
+	row.Set("status", c.Status)
+	row.Set("error", c.Err.Error())
+	row.Set("failures", failures)
+	row.Set("checked", types.NowDateTime())
+	if err := app.Save(row); err != nil {
+		return fmt.Errorf("[recordBrokenAsset][save]: %w", err)
+	}
+
+	if c.Status != http.StatusNotFound {
+		return nil
+	}
+	asset, err := assets.find("url", c.URL)
+	if err != nil {
+		return fmt.Errorf("[recordBrokenAsset]%w", err)
+	}
+	if asset != nil {
+		if err := app.Delete(asset); err != nil {
+			return fmt.Errorf("[recordBrokenAsset][delete] %s: %w", asset.GetString("key"), err)
+		}
+	}
+	return nil
+}
+
+// brokenRecords returns the IDs of a collection's records with a broken asset.
+func brokenRecords(app core.App, collection string) (map[string]bool, error) {
+	rows, err := app.FindRecordsByFilter(assetChecksCollection, "collection = {:collection}", "", 0, 0, dbx.Params{"collection": collection})
+	if err != nil {
+		return nil, fmt.Errorf("[brokenRecords][FindRecordsByFilter]: %w", err)
+	}
+	ids := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		ids[row.GetString("record")] = true
+	}
+	return ids, nil
+}
+
+// logHealthReport logs each broken asset and a summary line.
+func logHealthReport(report healthReport) {
+	for _, c := range report.Broken {
+		log.Printf("[check-assets] broken %s/%s %s: %v", c.Collection, c.Record, c.Field, c.Err)
+	}
+	log.Printf("[check-assets] %d checked, %d broken", report.Checked, len(report.Broken))
+}
+
+// scheduleAssetChecks runs the health check on the cron schedule (defaults to
+// defaultAssetCheckSchedule; "off" disables it) while the server is running.
+func scheduleAssetChecks(app core.App, assets *assetStore, schedule string) error {
+	if schedule == "off" {
+		return nil
+	}
+	if schedule == "" {
+		schedule = defaultAssetCheckSchedule
+	}
+
+	err := app.Cron().Add("assetHealthCheck", schedule, func() {
+		report, err := checkAssets(app, assets)
+		if err != nil {
+			log.Printf("[check-assets]: %v", err)
+			return
+		}
+		logHealthReport(report)
+	})
+	if err != nil {
+		return fmt.Errorf("[scheduleAssetChecks] %q: %w", schedule, err)
+	}
+	return nil
+}
+
+// newCheckAssetsCmd builds the `check-assets` command, which runs the health check once.
+func newCheckAssetsCmd(app core.App, assets *assetStore) *cobra.Command {
+	return &cobra.Command{
+		Use:          "check-assets",
+		Short:        "Check that every stored archive and cover can still be downloaded",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := checkAssets(app, assets)
+			if err != nil {
+				return err
+			}
+			logHealthReport(report)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,199 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	query "github.com/PuerkitoBio/goquery"
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Defaults for the limits on images mirrored from an article.
+const (
+	defaultImageMaxBytes  = 5 << 20
+	defaultImageMinPixels = 2
+	defaultImageMaxCount  = 50
+	imageTimeout          = 30 * time.Second
+)
+
+// errTrackingPixel is returned by mirrorImage for images too small to be content.
+var errTrackingPixel = errors.New("tracking pixel")
+
+// ImageOptions configures the images kept in archived articles.
+type ImageOptions struct {
+	Keep      bool  // keep images in every article, not just on sites whose rule keeps them
+	MaxBytes  int64 // larger images keep linking to their source
+	MinPixels int   // images narrower or shorter than this are dropped as tracking pixels
+	MaxCount  int   // images past this many keep linking to their source
+	// Mirror stores an image downloaded for the article under name and returns the
+	// URL the archive links to instead. nil leaves kept images linked to their source.
+	Mirror func(name string, data []byte, contentType string) (string, error)
+}
+
+// LoadImageOptions reads ARTICLE_IMAGES ("true" keeps images in every article) and
+// the ARTICLE_IMAGE_MAX_BYTES, ARTICLE_IMAGE_MIN_PIXELS and ARTICLE_IMAGE_MAX_COUNT
+// limits, which default to 5 MB, 2px and 50 images.
+func LoadImageOptions() (ImageOptions, error) {
+	keys := map[string]string{}
+	for _, name := range []string{"ARTICLE_IMAGES", "ARTICLE_IMAGE_MAX_BYTES", "ARTICLE_IMAGE_MIN_PIXELS", "ARTICLE_IMAGE_MAX_COUNT"} {
+		value, err := GetKeys(name)
+		if err != nil {
+			return ImageOptions{}, fmt.Errorf("[LoadImageOptions]%w", err)
+		}
+		keys[name] = value
+	}
+	return parseImageOptions(keys)
+}
+
+// parseImageOptions builds ImageOptions from the ARTICLE_IMAGE* keys; empty ones
+// take their defaults.
+func parseImageOptions(keys map[string]string) (ImageOptions, error) {
+	options := ImageOptions{
+		Keep:      keys["ARTICLE_IMAGES"] == "true",
+		MaxBytes:  defaultImageMaxBytes,
+		MinPixels: defaultImageMinPixels,
+		MaxCount:  defaultImageMaxCount,
+	}
+
+	for name, target := range map[string]*int{"ARTICLE_IMAGE_MIN_PIXELS": &options.MinPixels, "ARTICLE_IMAGE_MAX_COUNT": &options.MaxCount} {
+		if keys[name] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(keys[name])
+		if err != nil || n < 0 {
+			return ImageOptions{}, fmt.Errorf("[parseImageOptions]: %s must be a number, got %q", name, keys[name])
+		}
+		*target = n
+	}
+	if value := keys["ARTICLE_IMAGE_MAX_BYTES"]; value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 1 {
+			return ImageOptions{}, fmt.Errorf("[parseImageOptions]: ARTICLE_IMAGE_MAX_BYTES must be a positive number, got %q", value)
+		}
+		options.MaxBytes = n
+	}
+
+	return options, nil
+}
+
+// isTrackingPixel reports whether an img's width or height attribute is under
+// minPixels, so it can be dropped without being downloaded.
+func isTrackingPixel(s *query.Selection, minPixels int) bool {
+	for _, attr := range []string{"width", "height"} {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s.AttrOr(attr, "")), "px"))
+		if err == nil && n < minPixels {
+			return true
+		}
+	}
+	return false
+}
+
+// mirrorImages downloads the images in an article's HTML content and rewrites their
+// src to the URLs options.Mirror stores them at. Tracking pixels are dropped; images
+// that are too large, past MaxCount, or fail to download keep linking to their
+// source, and are logged.
+func mirrorImages(content string, pageURL *url.URL, options ImageOptions) (string, error) {
+	doc, err := query.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return "", fmt.Errorf("[mirrorImages][query.NewDocumentFromReader] %w", err)
+	}
+
+	client := &http.Client{Timeout: imageTimeout}
+	mirrored := map[string]string{} // source → mirrored URL, "" to keep the source
+	pixels := map[string]bool{}
+	var count int
+
+	doc.Find("img").Each(func(_ int, s *query.Selection) {
+		src, err := pageURL.Parse(strings.TrimSpace(s.AttrOr("src", "")))
+		if err != nil || (src.Scheme != "http" && src.Scheme != "https") {
+			return
+		}
+		if isTrackingPixel(s, options.MinPixels) || pixels[src.String()] {
+			s.Remove()
+			return
+		}
+
+		mirror, ok := mirrored[src.String()]
+		if !ok {
+			if count >= options.MaxCount {
+				log.Printf("[mirrorImages] %s: %d image limit reached, linking %s", pageURL, options.MaxCount, src)
+				return
+			}
+			count++
+
+			mirror, err = mirrorImage(client, src, fmt.Sprintf("image-%02d", count), options)
+			if errors.Is(err, errTrackingPixel) {
+				pixels[src.String()] = true
+				s.Remove()
+				return
+			}
+			if err != nil {
+				log.Printf("[mirrorImages] %s: %v", pageURL, err)
+			}
+			mirrored[src.String()] = mirror
+		}
+		if mirror == "" {
+			return
+		}
+
+		s.SetAttr("src", mirror)
+		s.RemoveAttr("srcset")
+	})
+
+	// Alternative sources still point at the originals.
+	doc.Find("picture source").Remove()
+
+	html, err := doc.Find("body").Html()
+	if err != nil {
+		return "", fmt.Errorf("[mirrorImages][Html] %w", err)
+	}
+	return html, nil
+}
+
+// mirrorImage downloads the image at src and stores it through options.Mirror as
+// name, with the extension of its detected type.
+func mirrorImage(client *http.Client, src *url.URL, name string, options ImageOptions) (string, error) {
+	resp, err := client.Get(src.String())
+	if err != nil {
+		return "", fmt.Errorf("[mirrorImage][http.Get]: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("[mirrorImage]: %s answered %s", src, resp.Status)
+	}
+	if resp.ContentLength > options.MaxBytes {
+		return "", fmt.Errorf("[mirrorImage]: %s is larger than %d bytes", src, options.MaxBytes)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, options.MaxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("[mirrorImage][io.ReadAll]: %w", err)
+	}
+	if int64(len(data)) > options.MaxBytes {
+		return "", fmt.Errorf("[mirrorImage]: %s is larger than %d bytes", src, options.MaxBytes)
+	}
+
+	mime := mimetype.Detect(data)
+	if !strings.HasPrefix(mime.String(), "image/") {
+		return "", fmt.Errorf("[mirrorImage] %s is %s: %w", src, mime.String(), ErrNotImage)
+	}
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil && (config.Width < options.MinPixels || config.Height < options.MinPixels) {
+		return "", errTrackingPixel
+	}
+
+	mirror, err := options.Mirror(name+mime.Extension(), data, mime.String())
+	if err != nil {
+		return "", fmt.Errorf("[mirrorImage] %s: %w", src, err)
+	}
+	return mirror, nil
+}
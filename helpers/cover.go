@@ -0,0 +1,133 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/gabriel-vasile/mimetype"
+	_ "golang.org/x/image/webp" // registers the WebP decoder used by imaging.Decode
+)
+
+// ErrNotImage is returned by NormalizeCover when a provider sends something other
+// than an image (e.g. an HTML error page with a 200 status).
+var ErrNotImage = errors.New("not an image")
+
+// ErrCoverTooLarge is returned by NormalizeCover for images with more than
+// maxCoverPixels pixels, which would take too much memory to decode.
+var ErrCoverTooLarge = errors.New("cover too large")
+
+// Cover sizes, as the longest side in pixels, and the JPEG quality they're encoded at.
+const (
+	CoverMaxSize    = 1600
+	CoverMediumSize = 600
+	CoverSmallSize  = 200
+	coverQuality    = 85
+	maxCoverBytes   = 50 << 20
+	maxCoverPixels  = 50_000_000
+)
+
+// CoverThumbs maps the names of a cover's thumbnails (see ThumbKey) to their size.
+var CoverThumbs = map[string]int{"medium": CoverMediumSize, "small": CoverSmallSize}
+
+// coverExtensions maps the image types covers may end up stored as to file extensions.
+var coverExtensions = map[string]string{
+	"image/jpeg": ".jpeg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/avif": ".avif",
+}
+
+// NormalizedCover is a cover ready to store. Data is a JPEG capped at CoverMaxSize
+// with "medium" and "small" JPEG thumbnails, unless the source format can't be decoded
+// (e.g. AVIF): then Data is the source as-is, with its detected MIME and no thumbnails.
+type NormalizedCover struct {
+	Data       []byte
+	MIME       string
+	Thumbs     map[string][]byte
+	SourceMIME string
+}
+
+// NormalizeCover decodes a cover image whatever its format, re-encodes it as JPEG no
+// larger than CoverMaxSize on either side and renders the thumbnails. The source
+// type is detected from the content, not from headers or file names.
+func NormalizeCover(r io.Reader) (NormalizedCover, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxCoverBytes+1))
+	if err != nil {
+		return NormalizedCover{}, fmt.Errorf("[NormalizeCover][io.ReadAll]: %w", err)
+	}
+	if len(data) > maxCoverBytes {
+		return NormalizedCover{}, fmt.Errorf("[NormalizeCover]: cover larger than %d bytes", maxCoverBytes)
+	}
+
+	sourceMIME := mimetype.Detect(data).String()
+	if !strings.HasPrefix(sourceMIME, "image/") {
+		return NormalizedCover{}, fmt.Errorf("[NormalizeCover]: %w: %s", ErrNotImage, sourceMIME)
+	}
+
+	// A small file can declare huge dimensions; check them before decoding allocates
+	// the pixels.
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil && int64(cfg.Width)*int64(cfg.Height) > maxCoverPixels {
+		return NormalizedCover{}, fmt.Errorf("[NormalizeCover]: %w: %dx%d", ErrCoverTooLarge, cfg.Width, cfg.Height)
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if errors.Is(err, image.ErrFormat) {
+		log.Printf("[NormalizeCover]: no decoder for %s, storing it unchanged", sourceMIME)
+		return NormalizedCover{Data: data, MIME: sourceMIME, SourceMIME: sourceMIME}, nil
+	}
+	if err != nil {
+		return NormalizedCover{}, fmt.Errorf("[NormalizeCover][imaging.Decode] %s: %w", sourceMIME, err)
+	}
+
+	// JPEG has no alpha channel; flatten transparent PNG/WebP covers onto white.
+	bounds := img.Bounds()
+	img = imaging.Overlay(imaging.New(bounds.Dx(), bounds.Dy(), color.White), img, image.Point{}, 1)
+
+	cover := NormalizedCover{MIME: "image/jpeg", SourceMIME: sourceMIME, Thumbs: map[string][]byte{}}
+	if cover.Data, err = encodeCover(img, CoverMaxSize); err != nil {
+		return NormalizedCover{}, err
+	}
+	for name, size := range CoverThumbs {
+		if cover.Thumbs[name], err = encodeCover(img, size); err != nil {
+			return NormalizedCover{}, err
+		}
+	}
+
+	return cover, nil
+}
+
+// encodeCover scales img down to fit size×size (never up) and encodes it as JPEG.
+func encodeCover(img image.Image, size int) ([]byte, error) {
+	var buf bytes.Buffer
+	err := imaging.Encode(&buf, imaging.Fit(img, size, size, imaging.Lanczos), imaging.JPEG, imaging.JPEGQuality(coverQuality))
+	if err != nil {
+		return nil, fmt.Errorf("[encodeCover][imaging.Encode]: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// CoverFilename swaps filename's extension for the one matching mime, so a cover kept
+// in its source format isn't stored as ".jpeg".
+func CoverFilename(filename, mime string) string {
+	ext, ok := coverExtensions[mime]
+	if !ok {
+		return filename
+	}
+	return strings.TrimSuffix(filename, path.Ext(filename)) + ext
+}
+
+// ThumbKey returns the key of a cover's thumbnail, next to the cover itself
+// (e.g. "PocketBase/Books/Dune-0beec7b5ea3f0fdb-small.jpeg").
+func ThumbKey(coverKey, thumb string) string {
+	ext := path.Ext(coverKey)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(coverKey, ext), thumb, ext)
+}
@@ -0,0 +1,186 @@
+package helpers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	query "github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	readability "github.com/go-shiori/go-readability"
+
+	"golang.org/x/net/html"
+)
+
+// mediaSelectors are removed from every article, unless its rule keeps images.
+var mediaSelectors = []string{"img", "picture", "figure", "video", "iframe"}
+
+// Replacement rewrites every match of Pattern, a regular expression, in an article's
+// extracted content. With can refer to capture groups ($1).
+type Replacement struct {
+	Pattern string `json:"pattern"`
+	With    string `json:"with"`
+}
+
+// ExtractionRule tailors article extraction for one site.
+type ExtractionRule struct {
+	Host       string        // e.g. "wired.com"; also matches its subdomains
+	Remove     []string      // selectors removed before extraction (newsletter forms, sidebars)
+	Keep       []string      // when set, only the matching elements are extracted
+	Replace    []Replacement // applied to the extracted content, in order
+	KeepImages bool          // keep images, figures and embedded media
+}
+
+// normalizeHost lower-cases host and drops a leading "www.", so rules for
+// "www.wired.com" and "wired.com" are the same.
+func normalizeHost(host string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(host)), "www.")
+}
+
+// MatchRule returns the rule for host: the one for the host itself or else for its
+// closest parent domain ("video.wired.com" falls back to "wired.com"). ok is false
+// when no rule matches.
+func MatchRule(rules []ExtractionRule, host string) (rule ExtractionRule, ok bool) {
+	host = normalizeHost(host)
+	for _, r := range rules {
+		ruleHost := normalizeHost(r.Host)
+		if ruleHost == "" || (host != ruleHost && !strings.HasSuffix(host, "."+ruleHost)) {
+			continue
+		}
+		if !ok || len(ruleHost) > len(normalizeHost(rule.Host)) {
+			rule, ok = r, true
+		}
+	}
+	return rule, ok
+}
+
+// CheckSelectors returns an error for the first selector that doesn't compile.
+// goquery silently matches nothing for those, so rules are checked when saved.
+func CheckSelectors(selectors []string) error {
+	for _, selector := range selectors {
+		if _, err := cascadia.ParseGroup(selector); err != nil {
+			return fmt.Errorf("[CheckSelectors] %q: %w", selector, err)
+		}
+	}
+	return nil
+}
+
+// CheckReplacements returns an error for the first pattern that doesn't compile.
+func CheckReplacements(replacements []Replacement) error {
+	for _, r := range replacements {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("[CheckReplacements] %q: %w", r.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// keepOnly replaces the body of doc with the outermost elements matching selectors.
+// A page where none match (e.g. after a redesign) is left whole and logged.
+func keepOnly(doc *query.Document, selectors []string, pageURL *url.URL) {
+	group := strings.Join(selectors, ", ")
+	matched := doc.Find(group).FilterFunction(func(_ int, s *query.Selection) bool {
+		return s.ParentsFiltered(group).Length() == 0
+	})
+	if matched.Length() == 0 {
+		log.Printf("[keepOnly] %s: nothing matches %q, extracting the whole page", pageURL, group)
+		return
+	}
+
+	kept := matched.Remove()
+	body := doc.Find("body")
+	body.Empty()
+	body.AppendSelection(kept)
+}
+
+// extractArticle runs readability over the page in body, after applying the rule
+// matching its host (see ExtractionRule), and returns it as Markdown: YAML front
+// matter, a `# name` heading and the converted content. creator is the bookmark's
+// author; readability's byline stands in when it's blank. Images kept by the rule or
+// by images.Keep are mirrored through images.Mirror, when set.
+func extractArticle(name, creator string, body io.Reader, pageURL *url.URL, rules []ExtractionRule, images ImageOptions) ([]byte, error) {
+	doc, err := query.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("[extractArticle][query.NewDocumentFromReader] %w", err)
+	}
+
+	rule, _ := MatchRule(rules, pageURL.Hostname())
+
+	if len(rule.Keep) > 0 {
+		keepOnly(doc, rule.Keep, pageURL)
+	}
+
+	// remove annoyances
+	keepImages := rule.KeepImages || images.Keep
+	remove := rule.Remove
+	if !keepImages {
+		remove = append(remove[:len(remove):len(remove)], mediaSelectors...)
+	}
+	for _, selector := range remove {
+		doc.Find(selector).Remove()
+	}
+
+	// get html
+	htmlString, err := doc.Html()
+	if err != nil {
+		return nil, fmt.Errorf("[extractArticle][doc.Html] %w", err)
+	}
+
+	// get html node
+	htmlNode, err := html.Parse(strings.NewReader(htmlString))
+	if err != nil {
+		return nil, fmt.Errorf("[extractArticle][html.Parse] %w", err)
+	}
+
+	// get article and convert to markdown
+	article, err := readability.FromDocument(htmlNode, pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("[extractArticle][readability.FromReader] %w", err)
+	}
+	content := article.Content
+	if keepImages && images.Mirror != nil {
+		content, err = mirrorImages(content, pageURL, images)
+		if err != nil {
+			return nil, fmt.Errorf("[extractArticle]%w", err)
+		}
+	}
+	markdown, err := toMarkdown(content, pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("[extractArticle]%w", err)
+	}
+
+	// clean markdown
+	re1 := regexp.MustCompile(`([‘’]+)`)
+	re2 := regexp.MustCompile(`([“”]+)`)
+	markdown = re1.ReplaceAllString(markdown, `'`)
+	markdown = re2.ReplaceAllString(markdown, `"`)
+
+	for _, r := range rule.Replace {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("[extractArticle][regexp.Compile] %s: %w", rule.Host, err)
+		}
+		markdown = re.ReplaceAllString(markdown, r.With)
+	}
+
+	author := creator
+	if author == "" {
+		author = strings.TrimSpace(article.Byline)
+	}
+	frontMatter := articleFrontMatter{
+		Title:     name,
+		URL:       pageURL.String(),
+		Author:    author,
+		SiteName:  strings.TrimSpace(article.SiteName),
+		Published: article.PublishedTime,
+		Excerpt:   strings.TrimSpace(article.Excerpt),
+		WordCount: len(strings.Fields(article.TextContent)),
+	}
+
+	media := fmt.Sprintf("%s\n# %s\n\n%s\n", frontMatter, name, strings.TrimSpace(markdown))
+
+	return []byte(media), nil
+}
@@ -2,9 +2,11 @@ package helpers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"regexp"
 	"strings"
 )
@@ -60,10 +62,14 @@ func GetBookInfo(isbn string) (CleanBook, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return CleanBook{}, fmt.Errorf("[GetBookInfo][client.Do]: %w", err)
+		return CleanBook{}, &ProviderError{Provider: "openlibrary", Err: fmt.Errorf("[GetBookInfo][client.Do]: %w", err)}
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return CleanBook{}, newProviderError("openlibrary", resp, fmt.Errorf("[GetBookInfo]: %s", resp.Status))
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return CleanBook{}, fmt.Errorf("[GetBookInfo][io.ReadAll]: %w", err)
@@ -123,3 +129,163 @@ func GetBookInfo(isbn string) (CleanBook, error) {
 		CoverURL: coverURL,
 	}, nil
 }
+
+type googleBooksIdentifier struct {
+	Type       string `json:"type"`
+	Identifier string `json:"identifier"`
+}
+
+type googleBooksImageLinks struct {
+	SmallThumbnail string `json:"smallThumbnail"`
+	Thumbnail      string `json:"thumbnail"`
+	Small          string `json:"small"`
+	Medium         string `json:"medium"`
+	Large          string `json:"large"`
+	ExtraLarge     string `json:"extraLarge"`
+}
+
+type googleBooksVolumeInfo struct {
+	Title               string                  `json:"title"`
+	Authors             []string                `json:"authors"`
+	PublishedDate       string                  `json:"publishedDate"`
+	IndustryIdentifiers []googleBooksIdentifier `json:"industryIdentifiers"`
+	ImageLinks          googleBooksImageLinks   `json:"imageLinks"`
+}
+
+type googleBooksResponse struct {
+	TotalItems int `json:"totalItems"`
+	Items      []struct {
+		VolumeInfo googleBooksVolumeInfo `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+// mapGoogleVolume converts a Google Books volume into a CleanBook, picking the
+// largest available cover and forcing it onto https.
+func mapGoogleVolume(info googleBooksVolumeInfo) CleanBook {
+	var year int
+	if match := yearRe.FindString(info.PublishedDate); match != "" {
+		fmt.Sscanf(match, "%d", &year)
+	}
+
+	var isbn10, isbn13 string
+	for _, id := range info.IndustryIdentifiers {
+		switch id.Type {
+		case "ISBN_10":
+			isbn10 = id.Identifier
+		case "ISBN_13":
+			isbn13 = id.Identifier
+		}
+	}
+
+	links := info.ImageLinks
+	coverURL := ""
+	for _, link := range []string{links.ExtraLarge, links.Large, links.Medium, links.Small, links.Thumbnail, links.SmallThumbnail} {
+		if link != "" {
+			coverURL = link
+			break
+		}
+	}
+	coverURL = strings.Replace(coverURL, "http://", "https://", 1)
+	coverURL = strings.Replace(coverURL, "&edge=curl", "", 1)
+
+	return CleanBook{
+		Title:    info.Title,
+		Creator:  strings.Join(info.Authors, ", "),
+		Year:     year,
+		ISBN10:   isbn10,
+		ISBN13:   isbn13,
+		CoverURL: coverURL,
+	}
+}
+
+// searchGoogleBooks runs a volumes query and returns the first result.
+// DOCS: https://developers.google.com/books/docs/v1/using#PerformingSearch
+func searchGoogleBooks(query string) (CleanBook, error) {
+	params := neturl.Values{}
+	params.Set("q", query)
+	params.Set("maxResults", "1")
+	params.Set("printType", "books")
+
+	key, err := GetKeys("GOOGLE_BOOKS_KEY")
+	if err != nil {
+		return CleanBook{}, fmt.Errorf("[searchGoogleBooks]%w", err)
+	}
+	// The key is optional; without it requests share Google's anonymous quota.
+	if key != "" {
+		params.Set("key", key)
+	}
+
+	endpoint := fmt.Sprintf("https://www.googleapis.com/books/v1/volumes?%s", params.Encode())
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return CleanBook{}, fmt.Errorf("[searchGoogleBooks][http.NewRequest]: %w", err)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return CleanBook{}, &ProviderError{Provider: "googlebooks", Err: fmt.Errorf("[searchGoogleBooks][client.Do]: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return CleanBook{}, newProviderError("googlebooks", resp, fmt.Errorf("[searchGoogleBooks]: %s", resp.Status))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return CleanBook{}, fmt.Errorf("[searchGoogleBooks][io.ReadAll]: %w", err)
+	}
+
+	var result googleBooksResponse
+	if err = json.Unmarshal(body, &result); err != nil {
+		return CleanBook{}, fmt.Errorf("[searchGoogleBooks][json.Unmarshal]: %w", err)
+	}
+
+	if len(result.Items) == 0 {
+		return CleanBook{}, fmt.Errorf("[searchGoogleBooks]: no results for %q", query)
+	}
+
+	return mapGoogleVolume(result.Items[0].VolumeInfo), nil
+}
+
+// GetGoogleBookInfo looks a book up by ISBN in Google Books.
+func GetGoogleBookInfo(isbn string) (CleanBook, error) {
+	clean := strings.NewReplacer("-", "", " ", "").Replace(isbn)
+	book, err := searchGoogleBooks("isbn:" + clean)
+	if err != nil {
+		return CleanBook{}, fmt.Errorf("[GetGoogleBookInfo]%w", err)
+	}
+	return book, nil
+}
+
+// ErrIncompleteSearch is returned by SearchBookInfo when the title or author is blank.
+var ErrIncompleteSearch = errors.New("title and author are required")
+
+// bookSearchQuery builds a volumes query matching the title and author as phrases.
+// Unquoted, every word is a separate term and the `inauthor:` filter only applies to
+// the first one. Double quotes are dropped from the values, since Google has no way
+// to escape them inside a phrase.
+func bookSearchQuery(title, author string) (string, error) {
+	phrase := strings.NewReplacer(`"`, "").Replace
+	title, author = strings.TrimSpace(phrase(title)), strings.TrimSpace(phrase(author))
+	if title == "" || author == "" {
+		return "", fmt.Errorf("[bookSearchQuery]: %w", ErrIncompleteSearch)
+	}
+	return fmt.Sprintf(`intitle:"%s" inauthor:"%s"`, title, author), nil
+}
+
+// SearchBookInfo finds a book by title and author in Google Books, for records
+// without an ISBN.
+func SearchBookInfo(title, author string) (CleanBook, error) {
+	query, err := bookSearchQuery(title, author)
+	if err != nil {
+		return CleanBook{}, fmt.Errorf("[SearchBookInfo]%w", err)
+	}
+
+	book, err := searchGoogleBooks(query)
+	if err != nil {
+		return CleanBook{}, fmt.Errorf("[SearchBookInfo]%w", err)
+	}
+	return book, nil
+}
@@ -1,25 +1,20 @@
 package helpers
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
-	"regexp"
-	"strings"
 
 	"github.com/fourjuaneight/rivendell/utils"
-
-	query "github.com/PuerkitoBio/goquery"
-	readability "github.com/go-shiori/go-readability"
-
-	"golang.org/x/net/html"
 )
 
-// Get Markdown version of article from url.
-func GetArticle(name string, urlString string) ([]byte, error) {
+// Get Markdown version of article from url, written by creator. The page is cleaned
+// up with the extraction rule matching its host, after redirects (see ExtractionRule),
+// and its images kept according to images.
+func GetArticle(name string, creator string, urlString string, rules []ExtractionRule, images ImageOptions) ([]byte, error) {
 	// get html from url
 	resp, err := http.Get(urlString)
 	if err != nil {
@@ -33,127 +28,67 @@ func GetArticle(name string, urlString string) ([]byte, error) {
 		return nil, fmt.Errorf("[GetArticle][resp] %s", mgs)
 	}
 
-	// parse html
-	doc, err := query.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("[GetArticle][query.NewDocumentFromReader] %w", err)
-	}
-
-	// remove annoyances
-	cleanDoc := []string{
-		// WIRED
-		"div.newsletter-subscribe-form",
-		"div[class^='RecircMostPopularContiner']",
-		"div[data-attr-viewport-monitor]",
-		"div[class^='NewsletterSubscribeFormWrapper']",
-		"div[data-testid='NewsletterSubscribeFormWrapper']",
-		"div[class^='GenericCalloutWrapper']",
-		"div[data-testid='GenericCallout']",
-		"aside[class^='Sidebar']",
-		"aside[data-testid='SidebarEmbed']",
-		"div[class^='ContributorsWrapper']",
-		"div[data-testid='Contributors']",
-		// The Atlantic
-		"p[class^='ArticleRelatedContentLink']",
-		"div[class^='ArticleRelatedContentModule']",
-		"div[class^='ArticleBooksModule']",
-		// Ars Technica
-		"div.gallery",
-		"div.story-sidebar",
-		// Media
-		"img",
-		"picture",
-		"figure",
-		"video",
-		"iframe",
-	}
-	for _, selector := range cleanDoc {
-		doc.Find(selector).Each(func(i int, s *query.Selection) {
-			s.Remove()
-		})
-	}
-
-	// get html
-	htmlString, err := doc.Html()
-	if err != nil {
-		return nil, fmt.Errorf("[GetArticle][doc.Html] %w", err)
-	}
-
-	// get html node
-	htmlNode, err := html.Parse(strings.NewReader(htmlString))
+	article, err := extractArticle(name, creator, resp.Body, resp.Request.URL, rules, images)
 	if err != nil {
-		return nil, fmt.Errorf("[GetArticle][html.Parse] %w", err)
+		return nil, fmt.Errorf("[GetArticle]%w", err)
 	}
 
-	// get url object
-	pageURL, err := url.Parse(urlString)
-	if err != nil {
-		return nil, fmt.Errorf("[GetArticle][url.Parse] %w", err)
-	}
+	return article, nil
+}
 
-	// get article and convert to markdown
-	article, err := readability.FromDocument(htmlNode, pageURL)
+// Get media file from url as a stream. size is -1 when the server doesn't send a
+// Content-Length. The caller must close the body.
+func GetMedia(name string, url string) (io.ReadCloser, int64, error) {
+	resp, err := http.Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("[GetArticle][readability.FromReader] %w", err)
+		return nil, 0, fmt.Errorf("[GetMedia][http.Get]: %w", err)
 	}
-	markdown := article.Content
-
-	// clean markdown
-	re1 := regexp.MustCompile(`([‘’]+)`)
-	re2 := regexp.MustCompile(`([“”]+)`)
-	markdown = re1.ReplaceAllString(markdown, `'`)
-	markdown = re2.ReplaceAllString(markdown, `"`)
 
-	if strings.Contains(urlString, "wired") {
-		re3 := regexp.MustCompile(`([—]+)`)
-		markdown = re3.ReplaceAllString(markdown, "")
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("[GetMedia][resp] %d - %s", resp.StatusCode, resp.Status)
 	}
 
-	media := fmt.Sprintf("# %s\n\n%s", name, markdown)
-
-	return []byte(media), nil
+	return resp.Body, resp.ContentLength, nil
 }
 
-// Get media file from source URL.
-func GetMedia(name string, url string) ([]byte, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("[GetMedia][http.Get]: %w", err)
-	}
-
-	defer resp.Body.Close()
+// tempFile is a downloaded file that deletes itself when closed.
+type tempFile struct {
+	*os.File
+}
 
-	media, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("[GetMedia][io.ReadAll]: %w", err)
+func (f tempFile) Close() error {
+	closeErr := f.File.Close()
+	if err := utils.DeleteFiles([]string{f.Name()}); err != nil {
+		return err
 	}
-
-	return media, nil
+	return closeErr
 }
 
-// Get YouTube file from url.
-func GetYTVid(name string, url string) ([]byte, error) {
+// Get YouTube file from url. The video is downloaded to disk and streamed from there;
+// closing the reader deletes the file.
+func GetYTVid(name string, url string) (io.ReadCloser, int64, error) {
 	fileName := utils.FileNameFmt(name)
 	filePath := fileName + ".mp4"
 
 	// download video with the ytdl function
 	ytdlErr := utils.YTDL(url, filePath)
 	if ytdlErr != nil {
-		return nil, fmt.Errorf("[GetYTVid][YTDL]: %w", ytdlErr)
+		return nil, 0, fmt.Errorf("[GetYTVid][YTDL]: %w", ytdlErr)
 	}
 
-	// read downloaded file into buffer
-	media, err := os.ReadFile(filePath)
+	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("[GetYTVid][os.ReadFile]: %w", err)
+		return nil, 0, fmt.Errorf("[GetYTVid][os.Open]: %w", err)
 	}
 
-	dfErr := utils.DeleteFiles([]string{filePath})
-	if dfErr != nil {
-		return nil, fmt.Errorf("[GetYTVid][DeleteFiles]: %w", dfErr)
+	info, err := file.Stat()
+	if err != nil {
+		tempFile{file}.Close()
+		return nil, 0, fmt.Errorf("[GetYTVid][Stat]: %w", err)
 	}
 
-	return media, nil
+	return tempFile{file}, info.Size(), nil
 }
 
 // GetSingleFile captures a full-page HTML snapshot via single-file-cli and returns the bytes.
@@ -174,10 +109,17 @@ func GetSingleFile(urlString string) ([]byte, error) {
 	return output, nil
 }
 
-func GetContent(name string, url string, mediaType string) ([]byte, error) {
+// GetContent fetches a bookmark's content as a stream, with its size in bytes (-1
+// when unknown). Articles are extracted with rules and images. The caller must close
+// the reader.
+func GetContent(name string, creator string, url string, mediaType string, rules []ExtractionRule, images ImageOptions) (io.ReadCloser, int64, error) {
 	switch mediaType {
 	case "articles":
-		return GetArticle(name, url)
+		article, err := GetArticle(name, creator, url, rules, images)
+		if err != nil {
+			return nil, 0, err
+		}
+		return io.NopCloser(bytes.NewReader(article)), int64(len(article)), nil
 	case "videos":
 		return GetYTVid(name, url)
 	default:
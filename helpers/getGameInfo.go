@@ -151,10 +151,14 @@ limit 1;
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return CleanGame{}, fmt.Errorf("[GetGameInfo][client.Do]: %w", err)
+		return CleanGame{}, &ProviderError{Provider: "igdb", Err: fmt.Errorf("[GetGameInfo][client.Do]: %w", err)}
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return CleanGame{}, newProviderError("igdb", resp, fmt.Errorf("[GetGameInfo]: %s", resp.Status))
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return CleanGame{}, fmt.Errorf("[GetGameInfo][io.ReadAll]: %w", err)
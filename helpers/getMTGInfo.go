@@ -418,19 +418,19 @@ func SearchCard(name string, set string, number int) (ScryfallCardSelection, err
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("(SearchCard): request failed: %w", err)
+		return nil, &ProviderError{Provider: "scryfall", Err: fmt.Errorf("(SearchCard): request failed: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		errBody, _ := io.ReadAll(resp.Body)
 		log.Printf("[SearchCard] Error body: %s", string(errBody))
-		return nil, fmt.Errorf("(SearchCard): %d - %s | %s/%d",
+		return nil, newProviderError("scryfall", resp, fmt.Errorf("(SearchCard): %d - %s | %s/%d",
 			resp.StatusCode,
 			resp.Status,
 			set,
 			number,
-		)
+		))
 	}
 
 	var card ScryfallCardData
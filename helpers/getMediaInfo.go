@@ -22,8 +22,9 @@ type Movie struct {
 		PosterPath   string `json:"poster_path"`
 		BackdropPath string `json:"backdrop_path"`
 	} `json:"belongs_to_collection"`
-	Budget int `json:"budget"`
-	Genres []struct {
+	Budget  int     `json:"budget"`
+	Credits Credits `json:"credits"` // only with append_to_response=credits
+	Genres  []struct {
 		ID   int    `json:"id"`
 		Name string `json:"name"`
 	} `json:"genres"`
@@ -140,6 +141,9 @@ type TVShow struct {
 	Type        string  `json:"type"`
 	VoteAverage float64 `json:"vote_average"`
 	VoteCount   int     `json:"vote_count"`
+	ExternalIDs struct {
+		ImdbID string `json:"imdb_id"`
+	} `json:"external_ids"` // only with append_to_response=external_ids
 }
 
 type Credits struct {
@@ -185,6 +189,10 @@ type CleanMedia struct {
 	Year     string
 	Type     string
 	CoverURL string
+	TMDBID   int
+	IMDbID   string
+	Overview string
+	Runtime  int // minutes; per episode for shows
 }
 
 type searchResult struct {
@@ -251,14 +259,36 @@ func getDirector(category string, id string) (string, error) {
 		return "", fmt.Errorf("[getCredits][json.Unmarshal]: %w", err)
 	}
 
-	var creators []string
-	for _, crew := range results.Crew {
+	return creditDirectors(results), nil
+}
+
+// creditDirectors joins the names of a credit list's directors.
+func creditDirectors(credits Credits) string {
+	var directors []string
+	for _, crew := range credits.Crew {
 		if crew.Job == "Director" {
-			creators = append(creators, crew.Name)
+			directors = append(directors, crew.Name)
 		}
 	}
+	return strings.Join(directors, ", ")
+}
 
-	return strings.Join(creators, ", "), nil
+// showCreators joins the names of a show's creators.
+func showCreators(tv TVShow) string {
+	creators := make([]string, len(tv.CreatedBy))
+	for i, c := range tv.CreatedBy {
+		creators[i] = c.Name
+	}
+	return strings.Join(creators, ", ")
+}
+
+// showRuntime returns a show's typical episode length in minutes. TMDB often leaves
+// episode_run_time empty, so the latest episode's runtime is the fallback.
+func showRuntime(tv TVShow) int {
+	if len(tv.EpisodeRunTime) > 0 {
+		return tv.EpisodeRunTime[0]
+	}
+	return tv.LastEpisodeToAir.Runtime
 }
 
 func GetMediaInfo(url string) (CleanMedia, error) {
@@ -360,7 +390,7 @@ func tmdbGet(token, endpoint string) ([]byte, error) {
 
 	resp, err := (&http.Client{}).Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("[tmdbGet][client.Do]: %w", err)
+		return nil, &ProviderError{Provider: "tmdb", Err: fmt.Errorf("[tmdbGet][client.Do]: %w", err)}
 	}
 	defer resp.Body.Close()
 
@@ -370,7 +400,7 @@ func tmdbGet(token, endpoint string) ([]byte, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("[tmdbGet]: %s", resp.Status)
+		return nil, newProviderError("tmdb", resp, fmt.Errorf("[tmdbGet]: %s", resp.Status))
 	}
 
 	return body, nil
@@ -428,7 +458,8 @@ func SearchMedia(title string, year int, season int, mediaType string) (CleanMed
 
 	// DOCS: https://developer.themoviedb.org/reference/movie-details (movie)
 	//       https://developer.themoviedb.org/reference/tv-series-details (tv)
-	detailEndpoint := fmt.Sprintf("https://api.themoviedb.org/3/%s/%d", category, results.Results[bestIdx].ID)
+	// credits and external_ids ride along so directors and IMDb IDs need no extra calls.
+	detailEndpoint := fmt.Sprintf("https://api.themoviedb.org/3/%s/%d?append_to_response=credits,external_ids", category, results.Results[bestIdx].ID)
 	detailBody, err := tmdbGet(token, detailEndpoint)
 	if err != nil {
 		return CleanMedia{}, fmt.Errorf("[SearchMedia]: %w", err)
@@ -456,10 +487,15 @@ func SearchMedia(title string, year int, season int, mediaType string) (CleanMed
 		}
 		return CleanMedia{
 			Title:    movie.Title,
+			Creator:  creditDirectors(movie.Credits),
 			Genre:    genre,
 			Year:     fmt.Sprintf("%d", releaseYear),
 			Type:     "movies",
 			CoverURL: coverURL,
+			TMDBID:   movie.ID,
+			IMDbID:   movie.ImdbID,
+			Overview: movie.Overview,
+			Runtime:  movie.Runtime,
 		}, nil
 	}
 
@@ -500,9 +536,14 @@ func SearchMedia(title string, year int, season int, mediaType string) (CleanMed
 	}
 	return CleanMedia{
 		Title:    tv.Name,
+		Creator:  showCreators(tv),
 		Genre:    genre,
 		Year:     fmt.Sprintf("%d", releaseYear),
 		Type:     "shows",
 		CoverURL: coverURL,
+		TMDBID:   tv.ID,
+		IMDbID:   tv.ExternalIDs.ImdbID,
+		Overview: tv.Overview,
+		Runtime:  showRuntime(tv),
 	}, nil
 }
@@ -56,10 +56,14 @@ func discogsSearch(token string, params neturl.Values) ([]discogsSearchResult, e
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("[discogsSearch][client.Do]: %w", err)
+		return nil, &ProviderError{Provider: "discogs", Err: fmt.Errorf("[discogsSearch][client.Do]: %w", err)}
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, newProviderError("discogs", resp, fmt.Errorf("[discogsSearch]: %s", resp.Status))
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("[discogsSearch][io.ReadAll]: %w", err)
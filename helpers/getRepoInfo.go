@@ -97,11 +97,15 @@ func GetRepoInfo(url string) (CleanRepo, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return CleanRepo{}, fmt.Errorf("[GetRepoInfo][client.Do]: %w", err)
+		return CleanRepo{}, &ProviderError{Provider: "github", Err: fmt.Errorf("[GetRepoInfo][client.Do]: %w", err)}
 	}
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return CleanRepo{}, newProviderError("github", resp, fmt.Errorf("[GetRepoInfo]: %s", resp.Status))
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return CleanRepo{}, fmt.Errorf("[GetRepoInfo][io.ReadAll]: %w", err)
@@ -99,14 +99,14 @@ func GetYTInfo(url string) (CleanYT, error) {
 
 	resp, err := http.Get(fmt.Sprintf("%s&key=%s", urls.Endpoint, key))
 	if err != nil {
-		return CleanYT{}, fmt.Errorf("[GetYTInfo][http.Get]: %w", err)
+		return CleanYT{}, &ProviderError{Provider: "youtube", Err: fmt.Errorf("[GetYTInfo][http.Get]: %w", err)}
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("[fetch]: %d - %s (%s)", resp.StatusCode, resp.Status, urls.Link)
-		return CleanYT{}, fmt.Errorf("[GetYTInfo]%w", err)
+		return CleanYT{}, newProviderError("youtube", resp, fmt.Errorf("[GetYTInfo]%w", err))
 	}
 
 	body, err := io.ReadAll(resp.Body)
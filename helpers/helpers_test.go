@@ -1,7 +1,29 @@
 package helpers
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseGHURL(t *testing.T) {
@@ -284,3 +306,1289 @@ func TestParseDiscogsTitle(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 5, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "120", 2 * time.Minute},
+		{"zero seconds", "0", 0},
+		{"negative seconds", "-5", 0},
+		{"http date in future", "Sat, 16 May 2026 12:01:30 GMT", 90 * time.Second},
+		{"http date in past", "Sat, 16 May 2026 11:00:00 GMT", 0},
+		{"garbage", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.value, now)
+			if got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		name       string
+		attempt    int
+		jitter     float64
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{"first attempt full jitter", 1, 1, 0, time.Second},
+		{"second attempt doubles", 2, 1, 0, 2 * time.Second},
+		{"third attempt doubles again", 3, 1, 0, 4 * time.Second},
+		{"capped at max delay", 10, 1, 0, 10 * time.Second},
+		{"jitter scales delay", 3, 0.5, 0, 2 * time.Second},
+		{"zero jitter", 3, 0, 0, 0},
+		{"retry-after longer than backoff wins", 1, 1, time.Minute, time.Minute},
+		{"retry-after shorter than backoff ignored", 3, 1, time.Second, 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Backoff(tt.attempt, tt.jitter, tt.retryAfter)
+			if got != tt.want {
+				t.Errorf("Backoff(%d, %v, %v) = %v, want %v", tt.attempt, tt.jitter, tt.retryAfter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderErrorTransient(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		want       bool
+	}{
+		{"transport error", 0, true},
+		{"request timeout", 408, true},
+		{"rate limited", 429, true},
+		{"server error", 500, true},
+		{"service unavailable", 503, true},
+		{"bad request", 400, false},
+		{"unauthorized", 401, false},
+		{"not found", 404, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &ProviderError{Provider: "tmdb", StatusCode: tt.statusCode}
+			if got := err.Transient(); got != tt.want {
+				t.Errorf("Transient() with status %d = %v, want %v", tt.statusCode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapGoogleVolume(t *testing.T) {
+	tests := []struct {
+		name string
+		info googleBooksVolumeInfo
+		want CleanBook
+	}{
+		{
+			name: "full volume",
+			info: googleBooksVolumeInfo{
+				Title:         "Dune",
+				Authors:       []string{"Frank Herbert"},
+				PublishedDate: "1990-09-01",
+				IndustryIdentifiers: []googleBooksIdentifier{
+					{Type: "ISBN_10", Identifier: "0441172717"},
+					{Type: "ISBN_13", Identifier: "9780441172719"},
+				},
+				ImageLinks: googleBooksImageLinks{
+					Thumbnail: "http://books.google.com/books/content?id=abc&zoom=1&edge=curl",
+				},
+			},
+			want: CleanBook{
+				Title:    "Dune",
+				Creator:  "Frank Herbert",
+				Year:     1990,
+				ISBN10:   "0441172717",
+				ISBN13:   "9780441172719",
+				CoverURL: "https://books.google.com/books/content?id=abc&zoom=1",
+			},
+		},
+		{
+			name: "year-only date and multiple authors",
+			info: googleBooksVolumeInfo{
+				Title:         "Good Omens",
+				Authors:       []string{"Terry Pratchett", "Neil Gaiman"},
+				PublishedDate: "2006",
+			},
+			want: CleanBook{Title: "Good Omens", Creator: "Terry Pratchett, Neil Gaiman", Year: 2006},
+		},
+		{
+			name: "largest cover preferred",
+			info: googleBooksVolumeInfo{
+				Title: "Neuromancer",
+				ImageLinks: googleBooksImageLinks{
+					SmallThumbnail: "http://example.com/s",
+					Thumbnail:      "http://example.com/t",
+					Large:          "http://example.com/l",
+				},
+			},
+			want: CleanBook{Title: "Neuromancer", CoverURL: "https://example.com/l"},
+		},
+		{
+			name: "empty volume",
+			info: googleBooksVolumeInfo{},
+			want: CleanBook{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapGoogleVolume(tt.info); got != tt.want {
+				t.Errorf("mapGoogleVolume() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBookSearchQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		title  string
+		author string
+		want   string
+		err    error
+	}{
+		{"phrases are quoted", "The Left Hand of Darkness", "Ursula K. Le Guin", `intitle:"The Left Hand of Darkness" inauthor:"Ursula K. Le Guin"`, nil},
+		{"quotes can't break out", `Dune" inauthor:"x`, "Frank Herbert", `intitle:"Dune inauthor:x" inauthor:"Frank Herbert"`, nil},
+		{"whitespace is trimmed", "  Dune ", " Frank Herbert\n", `intitle:"Dune" inauthor:"Frank Herbert"`, nil},
+		{"empty title", "", "Frank Herbert", "", ErrIncompleteSearch},
+		{"empty author", "Dune", "", "", ErrIncompleteSearch},
+		{"only quotes", `""`, "Frank Herbert", "", ErrIncompleteSearch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bookSearchQuery(tt.title, tt.author)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("bookSearchQuery() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("bookSearchQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreditDirectors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"single director", `{"crew":[{"name":"Denis Villeneuve","job":"Director"},{"name":"Hans Zimmer","job":"Original Music Composer"}]}`, "Denis Villeneuve"},
+		{"co-directors", `{"crew":[{"name":"Lana Wachowski","job":"Director"},{"name":"Lilly Wachowski","job":"Director"}]}`, "Lana Wachowski, Lilly Wachowski"},
+		{"no director", `{"crew":[{"name":"Roger Deakins","job":"Director of Photography"}]}`, ""},
+		{"empty credits", `{}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var credits Credits
+			if err := json.Unmarshal([]byte(tt.json), &credits); err != nil {
+				t.Fatalf("json.Unmarshal: %v", err)
+			}
+			if got := creditDirectors(credits); got != tt.want {
+				t.Errorf("creditDirectors() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShowCreators(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"single creator", `{"created_by":[{"name":"Vince Gilligan"}]}`, "Vince Gilligan"},
+		{"multiple creators", `{"created_by":[{"name":"Matt Duffer"},{"name":"Ross Duffer"}]}`, "Matt Duffer, Ross Duffer"},
+		{"no creators", `{}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tv TVShow
+			if err := json.Unmarshal([]byte(tt.json), &tv); err != nil {
+				t.Fatalf("json.Unmarshal: %v", err)
+			}
+			if got := showCreators(tv); got != tt.want {
+				t.Errorf("showCreators() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShowRuntime(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want int
+	}{
+		{"episode run time", `{"episode_run_time":[47,52],"last_episode_to_air":{"runtime":60}}`, 47},
+		{"falls back to last episode", `{"episode_run_time":[],"last_episode_to_air":{"runtime":58}}`, 58},
+		{"unknown", `{}`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tv TVShow
+			if err := json.Unmarshal([]byte(tt.json), &tv); err != nil {
+				t.Fatalf("json.Unmarshal: %v", err)
+			}
+			if got := showRuntime(tv); got != tt.want {
+				t.Errorf("showRuntime() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		filename   string
+		want       string
+	}{
+		{"mapped folder", "books", "Dune.jpeg", "PocketBase/Books/Dune.jpeg"},
+		{"acronym folder", "mtg", "lea/Black_Lotus.jpeg", "PocketBase/MTG/lea/Black_Lotus.jpeg"},
+		{"nested bookmark path", "bookmarks", "Articles/Title.md", "PocketBase/Bookmarks/Articles/Title.md"},
+		{"unmapped collection", "comics", "x.png", "PocketBase/comics/x.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ObjectKey(tt.collection, tt.filename); got != tt.want {
+				t.Errorf("ObjectKey(%q, %q) = %q, want %q", tt.collection, tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashedName(t *testing.T) {
+	hash := "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33"
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"extension kept last", "Dune.jpeg", "Dune-0beec7b5ea3f0fdb.jpeg"},
+		{"nested path", "lea/Black_Lotus-back.jpeg", "lea/Black_Lotus-back-0beec7b5ea3f0fdb.jpeg"},
+		{"dots in the slug", "Articles/Mr. Robot.md", "Articles/Mr. Robot-0beec7b5ea3f0fdb.md"},
+		{"no extension", "Articles/README", "Articles/README-0beec7b5ea3f0fdb"},
+		{"dot in a folder only", "v1.2/README", "v1.2/README-0beec7b5ea3f0fdb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashedName(tt.filename, hash); got != tt.want {
+				t.Errorf("HashedName(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"plain key", "PocketBase/Books/Dune.jpeg", "PocketBase/Books/Dune.jpeg"},
+		{"spaces", "PocketBase/Books/The Hobbit.jpeg", "PocketBase/Books/The%20Hobbit.jpeg"},
+		{"reserved characters", "PocketBase/CDs/AC?DC#1.jpeg", "PocketBase/CDs/AC%3FDC%231.jpeg"},
+		{"unicode", "PocketBase/Books/Café.jpeg", "PocketBase/Books/Caf%C3%A9.jpeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeKey(tt.key); got != tt.want {
+				t.Errorf("escapeKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	store, err := NewLocalStorageAt(t.TempDir(), "http://localhost/storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := ObjectKey("books", "The Hobbit.jpeg")
+	data := []byte("cover bytes")
+
+	object, err := store.Put(key, bytes.NewReader(data), int64(len(data)), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if want := "http://localhost/storage/PocketBase/Books/The%20Hobbit.jpeg"; object.URL != want {
+		t.Errorf("Put URL = %q, want %q", object.URL, want)
+	}
+	if object.Key != key {
+		t.Errorf("Put key = %q, want %q", object.Key, key)
+	}
+
+	if keys, err := store.List("PocketBase/Books/"); err != nil || len(keys) != 1 || keys[0] != key {
+		t.Errorf("List = %v, %v; want [%q], nil", keys, err, key)
+	}
+
+	if ok, err := store.Exists(key); err != nil || !ok {
+		t.Errorf("Exists after Put = %v, %v; want true, nil", ok, err)
+	}
+
+	got, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("Get = %q, want %q", got, data)
+	}
+
+	body, err := store.Open(key)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, err = io.ReadAll(body)
+	body.Close()
+	if err != nil || string(got) != string(data) {
+		t.Errorf("Open = %q, %v; want %q", got, err, data)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Errorf("Delete of missing object = %v, want nil", err)
+	}
+	if ok, err := store.Exists(key); err != nil || ok {
+		t.Errorf("Exists after Delete = %v, %v; want false, nil", ok, err)
+	}
+	if _, err := store.Get(key); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrObjectNotFound", err)
+	}
+	if _, err := store.Open(key); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Open after Delete error = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestGetKeys(t *testing.T) {
+	t.Setenv("TMDB_KEY", "from-env")
+
+	t.Run("no .env", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		for key, want := range map[string]string{"TMDB_KEY": "from-env", "LINK_DEAD_AFTER": ""} {
+			if got, err := GetKeys(key); err != nil || got != want {
+				t.Errorf("GetKeys(%q) = %q, %v; want %q", key, got, err, want)
+			}
+		}
+	})
+
+	t.Run("unreadable .env", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Mkdir(dir+"/.env", 0o700); err != nil {
+			t.Fatal(err)
+		}
+		t.Chdir(dir)
+		if _, err := GetKeys("TMDB_KEY"); err == nil {
+			t.Error("GetKeys with a directory for .env = nil error")
+		}
+	})
+}
+
+func TestIsB2AuthError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"expired token", &ProviderError{Provider: "b2", StatusCode: 401, Err: &B2Error{Status: 401, Code: "expired_auth_token"}}, true},
+		{"bad token", &ProviderError{Provider: "b2", StatusCode: 401, Err: &B2Error{Status: 401, Code: "bad_auth_token"}}, true},
+		{"unauthorized capability", &ProviderError{Provider: "b2", StatusCode: 401, Err: &B2Error{Status: 401, Code: "unauthorized"}}, false},
+		{"bodiless 401", &ProviderError{Provider: "b2", StatusCode: 401, Err: errors.New("401 Unauthorized")}, true},
+		{"service unavailable", &ProviderError{Provider: "b2", StatusCode: 503, Err: &B2Error{Status: 503, Code: "service_unavailable"}}, false},
+		{"plain error", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isB2AuthError(tt.err); got != tt.want {
+				t.Errorf("isB2AuthError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestB2UploadPool(t *testing.T) {
+	t.Cleanup(func() { b2UploadPool = nil })
+
+	fresh := B2UploadTokens{Endpoint: "https://pod-1/upload", Expires: time.Now().Add(time.Hour)}
+	stale := B2UploadTokens{Endpoint: "https://pod-2/upload", Expires: time.Now().Add(-time.Minute)}
+
+	// The stale URL is on top of the pool and must be skipped.
+	releaseUploadUrl(fresh)
+	releaseUploadUrl(stale)
+
+	got, err := acquireUploadUrl()
+	if err != nil {
+		t.Fatalf("acquireUploadUrl: %v", err)
+	}
+	if got.Endpoint != fresh.Endpoint {
+		t.Errorf("acquireUploadUrl() = %q, want %q", got.Endpoint, fresh.Endpoint)
+	}
+	if len(b2UploadPool) != 0 {
+		t.Errorf("pool has %d URLs after acquire, want 0", len(b2UploadPool))
+	}
+
+	releaseUploadUrl(got)
+	invalidateB2Auth()
+	if len(b2UploadPool) != 0 {
+		t.Errorf("pool has %d URLs after invalidateB2Auth, want 0", len(b2UploadPool))
+	}
+}
+
+func TestB2PartSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		recommended int
+		size        int64
+		want        int
+	}{
+		{name: "recommended size for unknown length", recommended: 5000, size: -1, want: 5000},
+		{name: "shrinks to a smaller known length", recommended: 5000, size: 120, want: 120},
+		{name: "recommended size for larger files", recommended: 5000, size: 9000, want: 5000},
+		{name: "default when none recommended", recommended: 0, size: -1, want: defaultB2PartSize},
+		{name: "empty file", recommended: 5000, size: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b2PartSize(tt.recommended, tt.size); got != tt.want {
+				t.Errorf("b2PartSize(%d, %d) = %d, want %d", tt.recommended, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestB2StoragePut(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/.env", []byte("B2_BUCKET_ID=bucket\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	// The fake B2 API answers the single-request upload, and the large file calls
+	// with each part recorded.
+	var (
+		calls []string
+		parts []int
+		total int
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := fmt.Sprintf("%x", sha1.Sum(body))
+		call := path.Base(r.URL.Path)
+		calls = append(calls, call)
+
+		var resp any
+		switch call {
+		case "upload":
+			resp = map[string]any{"fileId": "small", "fileName": r.Header.Get("X-Bz-File-Name"), "contentLength": len(body), "contentSha1": sum}
+		case "b2_start_large_file":
+			resp = map[string]any{"fileId": "large", "fileName": "Large.bin"}
+		case "b2_get_upload_part_url":
+			resp = map[string]any{"uploadUrl": srv.URL + "/part", "authorizationToken": "part"}
+		case "part":
+			parts = append(parts, len(body))
+			total += len(body)
+			resp = map[string]any{"contentLength": len(body), "contentSha1": sum}
+		case "b2_finish_large_file":
+			resp = map[string]any{"fileId": "large", "fileName": "Large.bin", "contentLength": total}
+		default:
+			http.Error(w, "unexpected call", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	b2AuthMu.Lock()
+	b2Auth = B2AuthTokens{ApiUrl: srv.URL, AuthorizationToken: "token", DownloadUrl: srv.URL, RecommendedPartSize: 4}
+	b2AuthExp = time.Now().Add(time.Hour)
+	b2AuthMu.Unlock()
+	t.Cleanup(invalidateB2Auth)
+	releaseUploadUrl(B2UploadTokens{Endpoint: srv.URL + "/upload", AuthToken: "upload", Expires: time.Now().Add(time.Hour)})
+
+	tests := []struct {
+		name  string
+		data  string
+		size  int64
+		calls []string
+		parts []int
+	}{
+		{"under a part", "abc", -1, []string{"upload"}, nil},
+		{"exactly a part", "abcd", -1, []string{"upload"}, nil},
+		{"known size under a part", "abc", 3, []string{"upload"}, nil},
+		{"parts with a remainder", "abcdefghi", -1, []string{"b2_start_large_file", "b2_get_upload_part_url", "part", "part", "part", "b2_finish_large_file"}, []int{4, 4, 1}},
+		{"whole parts", "abcdefgh", 8, []string{"b2_start_large_file", "b2_get_upload_part_url", "part", "part", "b2_finish_large_file"}, []int{4, 4}},
+	}
+
+	store := &B2Storage{bucketName: "bucket"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, parts, total = nil, nil, 0
+
+			object, err := store.Put("Test.bin", strings.NewReader(tt.data), tt.size, "application/octet-stream")
+			if err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if strings.Join(calls, ",") != strings.Join(tt.calls, ",") {
+				t.Errorf("calls = %v, want %v", calls, tt.calls)
+			}
+			if fmt.Sprint(parts) != fmt.Sprint(tt.parts) {
+				t.Errorf("parts = %v, want %v", parts, tt.parts)
+			}
+			if tt.parts != nil && total != len(tt.data) {
+				t.Errorf("uploaded %d bytes in parts, want %d", total, len(tt.data))
+			}
+			if object.URL == "" {
+				t.Error("Put returned no URL")
+			}
+		})
+	}
+}
+
+func TestNormalizeCover(t *testing.T) {
+	encodePNG := func(width, height int, fill color.Color) []byte {
+		img := image.NewNRGBA(image.Rect(0, 0, width, height)) // transparent
+		if fill != nil {
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					img.Set(x, y, fill)
+				}
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	// pngHeader is a PNG cut off after its header: enough to declare the dimensions
+	// without the pixels.
+	pngHeader := func(width, height uint32) []byte {
+		ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), width)
+		ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+		ihdr = append(ihdr, 8, 2, 0, 0, 0) // 8-bit RGB
+		data := binary.BigEndian.AppendUint32([]byte("\x89PNG\r\n\x1a\n"), uint32(len(ihdr)-4))
+		data = append(data, ihdr...)
+		return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantSize   image.Point
+		wantMedium image.Point
+		wantSmall  image.Point
+		wantSource string
+		wantErr    error
+	}{
+		{
+			name:       "large PNG is capped",
+			data:       encodePNG(3200, 1600, color.Black),
+			wantSize:   image.Pt(1600, 800),
+			wantMedium: image.Pt(600, 300),
+			wantSmall:  image.Pt(200, 100),
+			wantSource: "image/png",
+		},
+		{
+			name:       "small image is never upscaled",
+			data:       encodePNG(100, 150, nil),
+			wantSize:   image.Pt(100, 150),
+			wantMedium: image.Pt(100, 150),
+			wantSmall:  image.Pt(100, 150),
+			wantSource: "image/png",
+		},
+		{
+			name:    "HTML error page",
+			data:    []byte("<!doctype html><html><body>Not found</body></html>"),
+			wantErr: ErrNotImage,
+		},
+		{
+			name:    "too many pixels to decode",
+			data:    pngHeader(20000, 20000),
+			wantErr: ErrCoverTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cover, err := NormalizeCover(bytes.NewReader(tt.data))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("NormalizeCover() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cover.MIME != "image/jpeg" || cover.SourceMIME != tt.wantSource {
+				t.Errorf("MIME = %q, SourceMIME = %q; want image/jpeg, %q", cover.MIME, cover.SourceMIME, tt.wantSource)
+			}
+
+			for name, want := range map[string]image.Point{"cover": tt.wantSize, "medium": tt.wantMedium, "small": tt.wantSmall} {
+				data := cover.Data
+				if name != "cover" {
+					data = cover.Thumbs[name]
+				}
+				cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("%s: not a JPEG: %v", name, err)
+				}
+				if got := image.Pt(cfg.Width, cfg.Height); got != want {
+					t.Errorf("%s size = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCoverFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		mime     string
+		want     string
+	}{
+		{"Dune.jpeg", "image/jpeg", "Dune.jpeg"},
+		{"Dune.jpeg", "image/avif", "Dune.avif"},
+		{"Dune.v2.png", "image/jpeg", "Dune.v2.jpeg"},
+		{"Dune.jpeg", "image/x-unknown", "Dune.jpeg"},
+	}
+
+	for _, tt := range tests {
+		if got := CoverFilename(tt.filename, tt.mime); got != tt.want {
+			t.Errorf("CoverFilename(%q, %q) = %q, want %q", tt.filename, tt.mime, got, tt.want)
+		}
+	}
+}
+
+func TestThumbKey(t *testing.T) {
+	got := ThumbKey("PocketBase/Books/Dune-0beec7b5ea3f0fdb.jpeg", "small")
+	if want := "PocketBase/Books/Dune-0beec7b5ea3f0fdb-small.jpeg"; got != want {
+		t.Errorf("ThumbKey() = %q, want %q", got, want)
+	}
+}
+
+func TestVerifyB2Upload(t *testing.T) {
+	const sha = "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33"
+
+	tests := []struct {
+		name       string
+		gotSha1    string
+		gotLength  int64
+		wantSha1   string
+		wantLength int64
+		wantErr    bool
+	}{
+		{"match", sha, 3, sha, 3, false},
+		{"hash case differs", strings.ToUpper(sha), 3, sha, 3, false},
+		{"truncated", sha, 2, sha, 3, true},
+		{"different content", "da39a3ee5e6b4b0d3255bfef95601890afd80709", 3, sha, 3, true},
+		{"large file reports no hash", "none", 3, "", 3, false},
+		{"large file short", "none", 2, "", 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyB2Upload(tt.gotSha1, tt.gotLength, tt.wantSha1, tt.wantLength)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyB2Upload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUploadMismatch) {
+				t.Errorf("verifyB2Upload() error = %v, want ErrUploadMismatch", err)
+			}
+		})
+	}
+}
+
+// warcRecord is a parsed WARC record: its headers and block.
+type warcRecord struct {
+	header map[string]string
+	block  []byte
+}
+
+// readWARC splits a WARC file into records, checking the framing as it goes.
+func readWARC(t *testing.T, data []byte) []warcRecord {
+	t.Helper()
+	var records []warcRecord
+	for len(data) > 0 {
+		head, rest, ok := bytes.Cut(data, []byte("\r\n\r\n"))
+		if !ok {
+			t.Fatalf("record without a header terminator: %q", data)
+		}
+		lines := strings.Split(string(head), "\r\n")
+		if lines[0] != "WARC/1.1" {
+			t.Fatalf("record starts with %q, want WARC/1.1", lines[0])
+		}
+		header := map[string]string{}
+		for _, line := range lines[1:] {
+			name, value, _ := strings.Cut(line, ": ")
+			header[name] = value
+		}
+		length, err := strconv.Atoi(header["Content-Length"])
+		if err != nil || length > len(rest) {
+			t.Fatalf("bad Content-Length %q", header["Content-Length"])
+		}
+		if !bytes.HasPrefix(rest[length:], []byte("\r\n\r\n")) {
+			t.Fatalf("record block isn't followed by CRLF CRLF")
+		}
+		records = append(records, warcRecord{header: header, block: rest[:length]})
+		data = rest[length+4:]
+	}
+	return records
+}
+
+func TestCaptureWARC(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head>
+				<link rel="stylesheet" href="/style.css">
+				<link rel="icon" href="data:image/png;base64,AAAA">
+				<script src="/app.js"></script>
+			</head><body>
+				<img src="chart.png"><img src="/chart.png#again">
+				<a href="/elsewhere">not a subresource</a>
+			</body></html>`))
+		case "/old":
+			http.Redirect(w, r, "/article", http.StatusMovedPermanently)
+		case "/style.css":
+			w.Write([]byte("body { color: black }"))
+		case "/chart.png":
+			w.Write([]byte("png bytes"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	if err := CaptureWARC(&buf, srv.URL+"/old"); err != nil {
+		t.Fatal(err)
+	}
+	records := readWARC(t, buf.Bytes())
+
+	if records[0].header["WARC-Type"] != "warcinfo" {
+		t.Errorf("first record is %q, want warcinfo", records[0].header["WARC-Type"])
+	}
+
+	responses := map[string]warcRecord{}
+	for _, r := range records[1:] {
+		if r.header["WARC-Block-Digest"] != warcDigest(r.block) {
+			t.Errorf("%s: block digest doesn't match", r.header["WARC-Target-URI"])
+		}
+		if r.header["WARC-Type"] == "response" {
+			responses[strings.TrimPrefix(r.header["WARC-Target-URI"], srv.URL)] = r
+		}
+	}
+
+	var got []string
+	for path := range responses {
+		got = append(got, path)
+	}
+	sort.Strings(got)
+	want := []string{"/app.js", "/article", "/chart.png", "/style.css"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("captured %v, want %v", got, want)
+	}
+	if len(records) != 1+2*len(want) {
+		t.Errorf("%d records, want warcinfo plus a request and response per capture", len(records))
+	}
+
+	css := responses["/style.css"]
+	if !bytes.HasPrefix(css.block, []byte("HTTP/1.1 200 OK\r\n")) || !bytes.HasSuffix(css.block, []byte("\r\n\r\nbody { color: black }")) {
+		t.Errorf("stylesheet response = %q", css.block)
+	}
+	if css.header["WARC-Payload-Digest"] != warcDigest([]byte("body { color: black }")) {
+		t.Errorf("stylesheet payload digest = %q", css.header["WARC-Payload-Digest"])
+	}
+	if !bytes.HasPrefix(responses["/app.js"].block, []byte("HTTP/1.1 404 Not Found")) {
+		t.Errorf("missing script not recorded as a 404")
+	}
+
+	if err := CaptureWARC(&bytes.Buffer{}, srv.URL+"/missing"); err == nil {
+		t.Error("CaptureWARC of a 404 page succeeded, want an error")
+	}
+}
+
+func TestSavePageNow(t *testing.T) {
+	spnPollInterval = time.Millisecond
+	defer func() { spnPollInterval = 5 * time.Second }()
+
+	var polls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "LOW key:secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/save":
+			r.ParseForm()
+			if r.PostForm.Get("url") == "https://example.com/broken" {
+				w.Write([]byte(`{"job_id":"job-2"}`))
+				return
+			}
+			w.Write([]byte(`{"url":"https://example.com/a","job_id":"job-1"}`))
+		case r.URL.Path == "/save/status/job-1":
+			if polls++; polls < 3 {
+				w.Write([]byte(`{"status":"pending"}`))
+				return
+			}
+			w.Write([]byte(`{"status":"success","timestamp":"20261018040000","original_url":"https://example.com/a"}`))
+		case r.URL.Path == "/save/status/job-2":
+			w.Write([]byte(`{"status":"error","message":"Couldn't resolve host."}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	got, err := savePageNow(srv.URL+"/save", "LOW key:secret", "https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := srv.URL + "/web/20261018040000/https://example.com/a"; got != want {
+		t.Errorf("savePageNow() = %q, want %q", got, want)
+	}
+	if polls != 3 {
+		t.Errorf("polled %d times, want until success (3)", polls)
+	}
+
+	if _, err := savePageNow(srv.URL+"/save", "LOW key:secret", "https://example.com/broken"); err == nil {
+		t.Error("failed capture returned no error")
+	}
+	if _, err := savePageNow(srv.URL+"/save", "", "https://example.com/a"); err == nil {
+		t.Error("rejected credentials returned no error")
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	rules := []ExtractionRule{
+		{Host: "wired.com"},
+		{Host: "www.theatlantic.com"},
+		{Host: "Video.Wired.com"},
+		{Host: ""},
+	}
+
+	cases := []struct {
+		host string
+		want string // matched rule's host; "" for none
+	}{
+		{"wired.com", "wired.com"},
+		{"www.wired.com", "wired.com"},
+		{"video.wired.com", "Video.Wired.com"},
+		{"live.video.wired.com", "Video.Wired.com"},
+		{"theatlantic.com", "www.theatlantic.com"},
+		{"notwired.com", ""},
+		{"wired.com.example.org", ""},
+		{"example.com", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.host, func(t *testing.T) {
+			rule, ok := MatchRule(rules, c.host)
+			if ok != (c.want != "") || rule.Host != c.want {
+				t.Errorf("MatchRule(%q) = %q, %v; want %q", c.host, rule.Host, ok, c.want)
+			}
+		})
+	}
+}
+
+func TestCheckExtractionRules(t *testing.T) {
+	selectors := []struct {
+		selector string
+		valid    bool
+	}{
+		{"div.newsletter", true},
+		{"div[class^='Sidebar'], aside", true},
+		{"div[data-testid='Contributors']", true},
+		{"div[class^='Sidebar'", false},
+		{"p >", false},
+	}
+	for _, c := range selectors {
+		if err := CheckSelectors([]string{c.selector}); (err == nil) != c.valid {
+			t.Errorf("CheckSelectors(%q) = %v, want valid %v", c.selector, err, c.valid)
+		}
+	}
+
+	patterns := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"—+", true},
+		{`\s+$`, true},
+		{"(unclosed", false},
+	}
+	for _, c := range patterns {
+		if err := CheckReplacements([]Replacement{{Pattern: c.pattern}}); (err == nil) != c.valid {
+			t.Errorf("CheckReplacements(%q) = %v, want valid %v", c.pattern, err, c.valid)
+		}
+	}
+}
+
+func TestExtractArticle(t *testing.T) {
+	wired := ExtractionRule{
+		Host:    "wired.com",
+		Remove:  []string{"div[data-testid='NewsletterSubscribeFormWrapper']", "aside[class^='Sidebar']", "div[data-testid='Contributors']"},
+		Replace: []Replacement{{Pattern: "—+", With: ""}},
+	}
+
+	cases := []struct {
+		name     string
+		fixture  string
+		pageURL  string
+		rules    []ExtractionRule
+		want     []string
+		excluded []string
+	}{
+		{
+			name:     "site rule removes widgets and em dashes",
+			fixture:  "wired.html",
+			pageURL:  "https://www.wired.com/story/battery-chemistry/",
+			rules:    []ExtractionRule{wired},
+			want:     []string{"# The Quiet Revolution\n\n", "lithium-ion cell", "grid storage", `"We stopped asking whether it could compete," one researcher told me`, "lithium's heavier"},
+			excluded: []string{"Sign up for our Science newsletter", "Most Popular", "Ada Lovelace", "—", "![", "<"},
+		},
+		{
+			name:     "other hosts only lose media",
+			fixture:  "wired.html",
+			pageURL:  "https://example.com/battery-chemistry/",
+			rules:    []ExtractionRule{wired},
+			want:     []string{"lithium-ion cell", "—"},
+			excluded: []string{"!["},
+		},
+		{
+			name:    "images kept",
+			fixture: "wired.html",
+			pageURL: "https://www.wired.com/story/battery-chemistry/",
+			rules:   []ExtractionRule{{Host: "wired.com", KeepImages: true}},
+			want:    []string{"![A prototype sodium cell](https://www.wired.com/photos/cell.jpg)", "A prototype sodium cell in a test rig."},
+		},
+		{
+			name:     "only kept elements extracted",
+			fixture:  "keep.html",
+			pageURL:  "https://blog.example.org/slow-software",
+			rules:    []ExtractionRule{{Host: "example.org", Keep: []string{"div.post-body"}}},
+			want:     []string{"Software gets slower", "Measuring is the first step", "Budgets turn performance"},
+			excluded: []string{"annual conference", "observability platform", "!["},
+		},
+		{
+			name:    "a keep selector matching nothing extracts the whole page",
+			fixture: "keep.html",
+			pageURL: "https://blog.example.org/slow-software",
+			rules:   []ExtractionRule{{Host: "example.org", Keep: []string{"article.entry"}}},
+			want:    []string{"Software gets slower"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", c.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			pageURL, err := url.Parse(c.pageURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			article, err := extractArticle("The Quiet Revolution", "", f, pageURL, c.rules, ImageOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(article)
+			for _, want := range c.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("article is missing %q:\n%s", want, got)
+				}
+			}
+			for _, excluded := range c.excluded {
+				if strings.Contains(got, excluded) {
+					t.Errorf("article contains %q:\n%s", excluded, got)
+				}
+			}
+		})
+	}
+}
+
+func TestArticleMarkdown(t *testing.T) {
+	cases := []struct {
+		name    string
+		creator string
+		want    []string
+	}{
+		{
+			name: "byline from the page",
+			want: []string{
+				"---\ntitle: \"Writing Fast Parsers\"\nurl: \"https://journal.example.com/posts/fast-parsers\"\nauthor: \"Grace Hopper\"\nsite_name: \"The Compiler Journal\"\npublished: 2024-03-05T13:30:00Z\nexcerpt: \"A tour of the tricks behind parsers that keep up with the disk.\"\nword_count: ",
+				"---\n\n# Writing Fast Parsers\n\n",
+				"## Start with the lexer",
+				"### Numbers",
+				"[lexing guide](https://journal.example.com/guides/lexing)",
+				"`pprof`",
+				"- Avoid allocating per token.",
+				"1. Measure.\n2. Change one thing.\n3. Measure again.",
+				"```\nfor i := 0; i < len(src); i++ {",
+				"> Premature optimization is the root of all evil",
+				"| Parser | MB/s |",
+				"| tuned  | 310  |",
+				"~~harder~~",
+			},
+		},
+		{
+			name:    "bookmark creator wins",
+			creator: "Ada Lovelace",
+			want:    []string{"author: \"Ada Lovelace\"\n"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "markup.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			pageURL, err := url.Parse("https://journal.example.com/posts/fast-parsers")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			article, err := extractArticle("Writing Fast Parsers", c.creator, f, pageURL, nil, ImageOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(article)
+			if !strings.HasPrefix(got, "---\n") {
+				t.Errorf("article doesn't start with front matter:\n%s", got)
+			}
+			for _, want := range c.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("article is missing %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestArticleFrontMatter(t *testing.T) {
+	published := time.Date(2024, 3, 5, 9, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	cases := []struct {
+		name string
+		fm   articleFrontMatter
+		want string
+	}{
+		{
+			name: "empty values left out",
+			fm:   articleFrontMatter{Title: "Notes", URL: "https://example.com/notes"},
+			want: "---\ntitle: \"Notes\"\nurl: \"https://example.com/notes\"\nword_count: 0\n---\n",
+		},
+		{
+			name: "quotes, colons and newlines escaped",
+			fm: articleFrontMatter{
+				Title:     `Go: "Simple" Isn't Easy`,
+				URL:       "https://example.com/go",
+				Author:    "Rob Pike",
+				SiteName:  "# Not a comment",
+				Published: &published,
+				Excerpt:   "First line\nsecond line",
+				WordCount: 1200,
+			},
+			want: "---\ntitle: \"Go: \\\"Simple\\\" Isn't Easy\"\nurl: \"https://example.com/go\"\nauthor: \"Rob Pike\"\nsite_name: \"# Not a comment\"\npublished: 2024-03-05T14:00:00Z\nexcerpt: \"First line\\nsecond line\"\nword_count: 1200\n---\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.fm.String(); got != c.want {
+				t.Errorf("String() =\n%s\nwant\n%s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseImageOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		want    ImageOptions
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			keys: map[string]string{},
+			want: ImageOptions{MaxBytes: defaultImageMaxBytes, MinPixels: defaultImageMinPixels, MaxCount: defaultImageMaxCount},
+		},
+		{
+			name: "configured",
+			keys: map[string]string{"ARTICLE_IMAGES": "true", "ARTICLE_IMAGE_MAX_BYTES": "1048576", "ARTICLE_IMAGE_MIN_PIXELS": "10", "ARTICLE_IMAGE_MAX_COUNT": "0"},
+			want: ImageOptions{Keep: true, MaxBytes: 1 << 20, MinPixels: 10, MaxCount: 0},
+		},
+		{name: "size not a number", keys: map[string]string{"ARTICLE_IMAGE_MAX_BYTES": "5MB"}, wantErr: true},
+		{name: "zero size", keys: map[string]string{"ARTICLE_IMAGE_MAX_BYTES": "0"}, wantErr: true},
+		{name: "negative count", keys: map[string]string{"ARTICLE_IMAGE_MAX_COUNT": "-1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseImageOptions(tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImageOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Keep != tt.want.Keep || got.MaxBytes != tt.want.MaxBytes || got.MinPixels != tt.want.MinPixels || got.MaxCount != tt.want.MaxCount) {
+				t.Errorf("parseImageOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMirrorImages(t *testing.T) {
+	encodePNG := func(width, height int) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	photo := encodePNG(40, 30)
+
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/photo.png", "/second.png":
+			w.Write(photo)
+		case "/pixel.png", "/beacon.gif":
+			w.Write(encodePNG(1, 1))
+		case "/huge.png":
+			w.Write(bytes.Repeat([]byte{0}, 4096))
+		case "/page.html":
+			w.Write([]byte("<!DOCTYPE html><html><body>Not found</body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	pageURL, err := url.Parse(srv.URL + "/posts/article")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		maxCount int
+		stored   []string
+		want     []string
+		excluded []string
+		fetched  map[string]int
+	}{
+		{
+			name: "images mirrored, pixels dropped, failures linked",
+			content: `<div>
+				<picture><source srcset="/photo.webp"><img src="/photo.png" srcset="/photo-2x.png 2x" alt="photo"></picture>
+				<img src="` + srv.URL + `/photo.png" alt="again">
+				<img src="/pixel.png" alt="pixel">
+				<img src="/beacon.gif" width="1" height="1" alt="beacon">
+				<img src="/huge.png" alt="huge">
+				<img src="/missing.png" alt="missing">
+				<img src="/page.html" alt="page">
+				<img src="data:image/png;base64,AAAA" alt="inline">
+			</div>`,
+			maxCount: 50,
+			stored:   []string{"image-01.png"},
+			want: []string{
+				`<img src="https://cdn.example.com/image-01.png" alt="photo"/>`,
+				`<img src="https://cdn.example.com/image-01.png" alt="again"/>`,
+				`src="/huge.png"`,
+				`src="/missing.png"`,
+				`src="/page.html"`,
+				`src="data:image/png;base64,AAAA"`,
+			},
+			excluded: []string{"pixel", "beacon", "<source", "srcset"},
+			fetched:  map[string]int{"/photo.png": 1, "/beacon.gif": 0, "/huge.png": 1},
+		},
+		{
+			name:     "images past the limit keep their source",
+			content:  `<div><img src="/photo.png" alt="first"><img src="/second.png" alt="second"></div>`,
+			maxCount: 1,
+			stored:   []string{"image-01.png"},
+			want:     []string{`src="https://cdn.example.com/image-01.png"`, `src="/second.png"`},
+			fetched:  map[string]int{"/second.png": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clear(hits)
+			var stored []string
+			options := ImageOptions{
+				MaxBytes:  2048,
+				MinPixels: 2,
+				MaxCount:  tt.maxCount,
+				Mirror: func(name string, data []byte, contentType string) (string, error) {
+					if contentType != "image/png" || !bytes.Equal(data, photo) {
+						t.Errorf("Mirror(%q) got %s, %d bytes", name, contentType, len(data))
+					}
+					stored = append(stored, name)
+					return "https://cdn.example.com/" + name, nil
+				},
+			}
+
+			got, err := mirrorImages(tt.content, pageURL, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(stored, ",") != strings.Join(tt.stored, ",") {
+				t.Errorf("stored %v, want %v", stored, tt.stored)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("content is missing %q:\n%s", want, got)
+				}
+			}
+			for _, excluded := range tt.excluded {
+				if strings.Contains(got, excluded) {
+					t.Errorf("content contains %q:\n%s", excluded, got)
+				}
+			}
+			for path, n := range tt.fetched {
+				if hits[path] != n {
+					t.Errorf("%s fetched %d times, want %d", path, hits[path], n)
+				}
+			}
+		})
+	}
+}
@@ -1,13 +1,16 @@
 package helpers
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 
 	"github.com/joho/godotenv"
 )
 
-// Get auth keys from .env file.
+// Get auth keys from .env file. Without a .env only the process environment is
+// read, so unset keys come back empty and callers fall back to their defaults.
 func GetKeys(key string) (string, error) {
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -15,36 +18,90 @@ func GetKeys(key string) (string, error) {
 	}
 	envPath := cwd + "/.env"
 	err = godotenv.Load(envPath)
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return "", fmt.Errorf("[GetAuthKeys]: %w", err)
 	}
 
 	APP_KEY_ID := os.Getenv("B2_APP_KEY_ID")
 	APP_KEY := os.Getenv("B2_APP_KEY")
+	ARTICLE_IMAGES := os.Getenv("ARTICLE_IMAGES")
+	ARTICLE_IMAGE_MAX_BYTES := os.Getenv("ARTICLE_IMAGE_MAX_BYTES")
+	ARTICLE_IMAGE_MAX_COUNT := os.Getenv("ARTICLE_IMAGE_MAX_COUNT")
+	ARTICLE_IMAGE_MIN_PIXELS := os.Getenv("ARTICLE_IMAGE_MIN_PIXELS")
+	ASSET_CHECK_SCHEDULE := os.Getenv("ASSET_CHECK_SCHEDULE")
+	ASSET_STORAGE := os.Getenv("ASSET_STORAGE")
 	BUCKET_ID := os.Getenv("B2_BUCKET_ID")
 	BUCKET_NAME := os.Getenv("B2_BUCKET_NAME")
+	BUCKET_PRIVATE := os.Getenv("B2_BUCKET_PRIVATE")
 	DISCOGS_TOKEN := os.Getenv("DISCOGS_TOKEN")
 	GH_TOKEN := os.Getenv("GH_TOKEN")
 	GH_USERNAME := os.Getenv("GH_USERNAME")
+	GOOGLE_BOOKS_KEY := os.Getenv("GOOGLE_BOOKS_KEY")
+	LINK_CHECK_SCHEDULE := os.Getenv("LINK_CHECK_SCHEDULE")
+	LINK_DEAD_AFTER := os.Getenv("LINK_DEAD_AFTER")
+	LOCAL_STORAGE_DIR := os.Getenv("LOCAL_STORAGE_DIR")
+	LOCAL_STORAGE_URL := os.Getenv("LOCAL_STORAGE_URL")
 	META_ID := os.Getenv("META_ID")
+	META_POLICY_DEFINITION := os.Getenv("META_POLICY_DEFINITION")
+	META_POLICY_GENRE := os.Getenv("META_POLICY_GENRE")
+	META_POLICY_PLATFORM := os.Getenv("META_POLICY_PLATFORM")
+	META_POLICY_TAGS := os.Getenv("META_POLICY_TAGS")
+	S3_ACCESS_KEY := os.Getenv("S3_ACCESS_KEY")
+	S3_BUCKET := os.Getenv("S3_BUCKET")
+	S3_ENDPOINT := os.Getenv("S3_ENDPOINT")
+	S3_FORCE_PATH_STYLE := os.Getenv("S3_FORCE_PATH_STYLE")
+	S3_PUBLIC_URL := os.Getenv("S3_PUBLIC_URL")
+	S3_REGION := os.Getenv("S3_REGION")
+	S3_SECRET_KEY := os.Getenv("S3_SECRET_KEY")
+	SPN_ACCESS_KEY := os.Getenv("SPN_ACCESS_KEY")
+	SPN_ENDPOINT := os.Getenv("SPN_ENDPOINT")
+	SPN_SECRET_KEY := os.Getenv("SPN_SECRET_KEY")
+	STORAGE_BACKEND := os.Getenv("STORAGE_BACKEND")
 	TMDB_KEY := os.Getenv("TMDB_KEY")
 	TWITCH_CLIENT_ID := os.Getenv("TWITCH_CLIENT_ID")
 	TWITCH_CLIENT_SECRET := os.Getenv("TWITCH_CLIENT_SECRET")
 	YOUTUBE_KEY := os.Getenv("YOUTUBE_KEY")
 
 	keys := map[string]string{
-		"APP_KEY_ID":         APP_KEY_ID,
-		"APP_KEY":            APP_KEY,
-		"BUCKET_ID":          BUCKET_ID,
-		"BUCKET_NAME":        BUCKET_NAME,
-		"DISCOGS_TOKEN":      DISCOGS_TOKEN,
-		"GH_TOKEN":           GH_TOKEN,
-		"GH_USERNAME":        GH_USERNAME,
-		"META_ID":            META_ID,
-		"TMDB_KEY":           TMDB_KEY,
-		"TWITCH_CLIENT_ID":   TWITCH_CLIENT_ID,
-		"TWITCH_CLIENT_SECRET": TWITCH_CLIENT_SECRET,
-		"YOUTUBE_KEY":        YOUTUBE_KEY,
+		"APP_KEY_ID":               APP_KEY_ID,
+		"APP_KEY":                  APP_KEY,
+		"ARTICLE_IMAGES":           ARTICLE_IMAGES,
+		"ARTICLE_IMAGE_MAX_BYTES":  ARTICLE_IMAGE_MAX_BYTES,
+		"ARTICLE_IMAGE_MAX_COUNT":  ARTICLE_IMAGE_MAX_COUNT,
+		"ARTICLE_IMAGE_MIN_PIXELS": ARTICLE_IMAGE_MIN_PIXELS,
+		"ASSET_CHECK_SCHEDULE":     ASSET_CHECK_SCHEDULE,
+		"ASSET_STORAGE":            ASSET_STORAGE,
+		"BUCKET_ID":                BUCKET_ID,
+		"BUCKET_NAME":              BUCKET_NAME,
+		"BUCKET_PRIVATE":           BUCKET_PRIVATE,
+		"DISCOGS_TOKEN":            DISCOGS_TOKEN,
+		"GH_TOKEN":                 GH_TOKEN,
+		"GH_USERNAME":              GH_USERNAME,
+		"GOOGLE_BOOKS_KEY":         GOOGLE_BOOKS_KEY,
+		"LINK_CHECK_SCHEDULE":      LINK_CHECK_SCHEDULE,
+		"LINK_DEAD_AFTER":          LINK_DEAD_AFTER,
+		"LOCAL_STORAGE_DIR":        LOCAL_STORAGE_DIR,
+		"LOCAL_STORAGE_URL":        LOCAL_STORAGE_URL,
+		"META_ID":                  META_ID,
+		"META_POLICY_DEFINITION":   META_POLICY_DEFINITION,
+		"META_POLICY_GENRE":        META_POLICY_GENRE,
+		"META_POLICY_PLATFORM":     META_POLICY_PLATFORM,
+		"META_POLICY_TAGS":         META_POLICY_TAGS,
+		"S3_ACCESS_KEY":            S3_ACCESS_KEY,
+		"S3_BUCKET":                S3_BUCKET,
+		"S3_ENDPOINT":              S3_ENDPOINT,
+		"S3_FORCE_PATH_STYLE":      S3_FORCE_PATH_STYLE,
+		"S3_PUBLIC_URL":            S3_PUBLIC_URL,
+		"S3_REGION":                S3_REGION,
+		"S3_SECRET_KEY":            S3_SECRET_KEY,
+		"SPN_ACCESS_KEY":           SPN_ACCESS_KEY,
+		"SPN_ENDPOINT":             SPN_ENDPOINT,
+		"SPN_SECRET_KEY":           SPN_SECRET_KEY,
+		"STORAGE_BACKEND":          STORAGE_BACKEND,
+		"TMDB_KEY":                 TMDB_KEY,
+		"TWITCH_CLIENT_ID":         TWITCH_CLIENT_ID,
+		"TWITCH_CLIENT_SECRET":     TWITCH_CLIENT_SECRET,
+		"YOUTUBE_KEY":              YOUTUBE_KEY,
 	}
 
 	return keys[key], nil
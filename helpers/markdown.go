@@ -0,0 +1,71 @@
+package helpers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/base"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/commonmark"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/strikethrough"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/table"
+)
+
+// articleFrontMatter is the YAML front matter at the top of an archived article.
+type articleFrontMatter struct {
+	Title     string
+	URL       string
+	Author    string
+	SiteName  string
+	Published *time.Time
+	Excerpt   string
+	WordCount int
+}
+
+// String renders the front matter between `---` lines. Strings are double-quoted
+// with Go escapes, which YAML reads the same way; empty values are left out.
+func (fm articleFrontMatter) String() string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, field := range [][2]string{
+		{"title", fm.Title},
+		{"url", fm.URL},
+		{"author", fm.Author},
+		{"site_name", fm.SiteName},
+	} {
+		if field[1] != "" {
+			fmt.Fprintf(&b, "%s: %s\n", field[0], strconv.Quote(field[1]))
+		}
+	}
+	if fm.Published != nil {
+		fmt.Fprintf(&b, "published: %s\n", fm.Published.UTC().Format(time.RFC3339))
+	}
+	if fm.Excerpt != "" {
+		fmt.Fprintf(&b, "excerpt: %s\n", strconv.Quote(fm.Excerpt))
+	}
+	fmt.Fprintf(&b, "word_count: %d\n", fm.WordCount)
+	b.WriteString("---\n")
+	return b.String()
+}
+
+// toMarkdown converts readability's HTML content to CommonMark, with GitHub-style
+// tables and strikethrough. Relative links resolve against pageURL.
+func toMarkdown(content string, pageURL *url.URL) (string, error) {
+	conv := converter.NewConverter(
+		converter.WithPlugins(
+			base.NewBasePlugin(),
+			commonmark.NewCommonmarkPlugin(),
+			table.NewTablePlugin(),
+			strikethrough.NewStrikethroughPlugin(),
+		),
+	)
+
+	markdown, err := conv.ConvertString(content, converter.WithDomain(pageURL.String()))
+	if err != nil {
+		return "", fmt.Errorf("[toMarkdown][ConvertString]: %w", err)
+	}
+	return markdown, nil
+}
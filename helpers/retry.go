@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ProviderError wraps a failed call to an external API with enough context for the
+// job queue to decide whether, and when, to retry it.
+type ProviderError struct {
+	Provider   string        // key into RetryPolicies (e.g. "tmdb", "b2")
+	StatusCode int           // 0 when the request never got a response
+	RetryAfter time.Duration // parsed from the Retry-After header, if any
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether the failure is worth retrying: transport errors
+// (timeouts, resets), request timeouts, rate limits, and server errors.
+func (e *ProviderError) Transient() bool {
+	switch {
+	case e.StatusCode == 0:
+		return true
+	case e.StatusCode == http.StatusRequestTimeout, e.StatusCode == http.StatusTooManyRequests:
+		return true
+	case e.StatusCode >= 500:
+		return true
+	}
+	return false
+}
+
+// newProviderError builds a ProviderError from a non-2xx response.
+func newProviderError(provider string, resp *http.Response, err error) *ProviderError {
+	return &ProviderError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		Err:        err,
+	}
+}
+
+// parseRetryAfter reads a Retry-After header value, which is either a number of
+// seconds or an HTTP date. Returns 0 when the value is missing, malformed or past.
+// DOCS: https://www.rfc-editor.org/rfc/rfc9110#field.retry-after
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+
+	return 0
+}
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// RetryPolicies holds the retry policy for each external provider.
+var RetryPolicies = map[string]RetryPolicy{
+	"b2":          {MaxAttempts: 6, BaseDelay: 30 * time.Second, MaxDelay: 30 * time.Minute},
+	"discogs":     {MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour},
+	"github":      {MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour},
+	"googlebooks": {MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour},
+	"igdb":        {MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour},
+	"openlibrary": {MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour},
+	"s3":          {MaxAttempts: 6, BaseDelay: 30 * time.Second, MaxDelay: 30 * time.Minute},
+	"scryfall":    {MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: 30 * time.Minute},
+	"tmdb":        {MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour},
+	"youtube":     {MaxAttempts: 3, BaseDelay: 5 * time.Minute, MaxDelay: 6 * time.Hour},
+}
+
+// DefaultRetryPolicy applies to providers without an entry in RetryPolicies.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+// GetRetryPolicy returns the retry policy for a provider.
+func GetRetryPolicy(provider string) RetryPolicy {
+	if policy, ok := RetryPolicies[provider]; ok {
+		return policy
+	}
+	return DefaultRetryPolicy
+}
+
+// Backoff returns the delay before the next attempt using exponential backoff with
+// full jitter. attempt is the number of attempts made so far (1-based); jitter is a
+// random value in [0, 1). A longer retryAfter requested by the provider always wins.
+func (p RetryPolicy) Backoff(attempt int, jitter float64, retryAfter time.Duration) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+
+	delay := time.Duration(float64(ceiling) * jitter)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// AsProviderError extracts a ProviderError from an error chain.
+func AsProviderError(err error) (*ProviderError, bool) {
+	var pErr *ProviderError
+	if errors.As(err, &pErr) {
+		return pErr, true
+	}
+	return nil, false
+}
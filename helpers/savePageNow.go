@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// How often and for how long a Save Page Now capture is polled before giving up.
+var (
+	spnPollInterval = 5 * time.Second
+	spnTimeout      = 2 * time.Minute
+)
+
+type spnSaveResp struct {
+	URL     string `json:"url"`
+	JobID   string `json:"job_id"`
+	Message string `json:"message"`
+}
+
+type spnStatusResp struct {
+	Status      string `json:"status"` // "pending", "success" or "error"
+	Timestamp   string `json:"timestamp"`
+	OriginalURL string `json:"original_url"`
+	Message     string `json:"message"`
+}
+
+// SavePageNow asks the Save Page Now endpoint in SPN_ENDPOINT (e.g.
+// https://web.archive.org/save) to capture pageURL and returns the snapshot's URL.
+// Returns "" without doing anything when no endpoint is configured. SPN_ACCESS_KEY
+// and SPN_SECRET_KEY are the archive.org S3-style keys, if the endpoint needs them
+// (Save Page Now 2 API).
+func SavePageNow(pageURL string) (string, error) {
+	keys := map[string]string{}
+	for _, name := range []string{"SPN_ENDPOINT", "SPN_ACCESS_KEY", "SPN_SECRET_KEY"} {
+		value, err := GetKeys(name)
+		if err != nil {
+			return "", fmt.Errorf("[SavePageNow]%w", err)
+		}
+		keys[name] = value
+	}
+	if keys["SPN_ENDPOINT"] == "" {
+		return "", nil
+	}
+
+	var auth string
+	if keys["SPN_ACCESS_KEY"] != "" {
+		auth = fmt.Sprintf("LOW %s:%s", keys["SPN_ACCESS_KEY"], keys["SPN_SECRET_KEY"])
+	}
+
+	snapshot, err := savePageNow(strings.TrimSuffix(keys["SPN_ENDPOINT"], "/"), auth, pageURL)
+	if err != nil {
+		return "", fmt.Errorf("[SavePageNow]%w", err)
+	}
+	return snapshot, nil
+}
+
+// savePageNow submits pageURL to endpoint, then polls the capture job until it's done.
+// The snapshot URL is built like the Wayback Machine's: {host}/web/{timestamp}/{url},
+// where {host} is the endpoint without its "/save" path.
+func savePageNow(endpoint, auth, pageURL string) (string, error) {
+	form := neturl.Values{"url": {pageURL}}
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("[savePageNow][http.NewRequest]: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var job spnSaveResp
+	if err := spnDo(req, auth, &job); err != nil {
+		return "", fmt.Errorf("[savePageNow]%w", err)
+	}
+	if job.JobID == "" {
+		return "", fmt.Errorf("[savePageNow]: no capture job: %s", job.Message)
+	}
+
+	deadline := time.Now().Add(spnTimeout)
+	for {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/status/%s", endpoint, neturl.PathEscape(job.JobID)), nil)
+		if err != nil {
+			return "", fmt.Errorf("[savePageNow][http.NewRequest]: %w", err)
+		}
+
+		var status spnStatusResp
+		if err := spnDo(req, auth, &status); err != nil {
+			return "", fmt.Errorf("[savePageNow]%w", err)
+		}
+
+		switch status.Status {
+		case "success":
+			original := status.OriginalURL
+			if original == "" {
+				original = pageURL
+			}
+			host := strings.TrimSuffix(endpoint, "/save")
+			return fmt.Sprintf("%s/web/%s/%s", host, status.Timestamp, original), nil
+		case "error":
+			return "", fmt.Errorf("[savePageNow]: capture failed: %s", status.Message)
+		}
+
+		if time.Now().After(deadline) {
+			return "", errors.New("[savePageNow]: capture still pending after " + spnTimeout.String())
+		}
+		time.Sleep(spnPollInterval)
+	}
+}
+
+// spnDo sends a Save Page Now API request and decodes its JSON response.
+func spnDo(req *http.Request, auth string, result any) error {
+	req.Header.Set("Accept", "application/json")
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return &ProviderError{Provider: "spn", Err: fmt.Errorf("[spnDo][client.Do]: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newProviderError("spn", resp, fmt.Errorf("[spnDo]: %s", resp.Status))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("[spnDo][json.NewDecoder]: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// ErrObjectNotFound is returned by Storage.Get when nothing is stored under the key.
+var ErrObjectNotFound = errors.New("object not found")
+
+// Object is a stored file. FileID is the backend's ID for this version (B2's fileId);
+// it's empty on backends that address objects by key alone.
+type Object struct {
+	Key    string
+	URL    string
+	FileID string
+}
+
+// Storage is where archives and covers are mirrored. Keys are full object paths
+// within the bucket or directory (see ObjectKey).
+type Storage interface {
+	// Put streams r under key and returns the stored object, including its public URL.
+	// size is the length of r in bytes, or -1 when unknown.
+	Put(key string, r io.Reader, size int64, contentType string) (Object, error)
+	Get(key string) ([]byte, error)
+	// Open streams the object stored under key; the caller closes it.
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the object; deleting a missing object is not an error.
+	Delete(key string) error
+	Exists(key string) (bool, error)
+	// List returns the keys of every object under prefix.
+	List(prefix string) ([]string, error)
+	PublicURL(key string) string
+}
+
+// Signer is implemented by backends that can keep objects private. PublicURL still
+// identifies an object, but downloading it takes a URL from SignedURL.
+type Signer interface {
+	// Private reports whether objects need a signed URL to be downloaded.
+	Private() bool
+	// SignedURL returns a download URL for key that stays valid for ttl.
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// pathMap maps collection names to their storage folder names.
+var pathMap = map[string]string{
+	"bookmarks": "Bookmarks",
+	"books":     "Books",
+	"cds":       "CDs",
+	"games":     "Games",
+	"movies":    "Movies",
+	"mtg":       "MTG",
+	"shows":     "Shows",
+	"vinyls":    "Vinyls",
+}
+
+// ObjectKey returns the storage key for a file in a collection's folder.
+// collection is the PocketBase collection name (e.g. "books") — looked up in pathMap
+// to determine the subfolder. filename is the path within that folder (e.g. "cover.jpeg").
+// Full path: PocketBase/{folder}/{filename}
+func ObjectKey(collection, filename string) string {
+	folder, ok := pathMap[collection]
+	if !ok {
+		folder = collection
+	}
+	return fmt.Sprintf("PocketBase/%s/%s", folder, filename)
+}
+
+// hashedNameLen is how many hex characters of the content hash go into a file name.
+const hashedNameLen = 16
+
+// HashedName adds a prefix of the content hash to filename, before its extension
+// (e.g. "Set/Name.jpeg" → "Set/Name-0beec7b5ea3f0fdb.jpeg"). Files with the same slug
+// but different content no longer overwrite each other, while the name stays readable.
+func HashedName(filename, hash string) string {
+	if len(hash) > hashedNameLen {
+		hash = hash[:hashedNameLen]
+	}
+	ext := path.Ext(filename)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(filename, ext), hash, ext)
+}
+
+// escapeKey percent-encodes each segment of a key for use in a URL, keeping the slashes.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = neturl.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// NewStorage returns the backend selected by STORAGE_BACKEND: "b2" (default), "s3"
+// or "local".
+func NewStorage() (Storage, error) {
+	backend, err := GetKeys("STORAGE_BACKEND")
+	if err != nil {
+		return nil, fmt.Errorf("[NewStorage]%w", err)
+	}
+
+	switch backend {
+	case "", "b2":
+		return NewB2Storage()
+	case "s3":
+		return NewS3Storage()
+	case "local":
+		return NewLocalStorage()
+	}
+	return nil, fmt.Errorf("[NewStorage]: unknown STORAGE_BACKEND %q", backend)
+}
+
+// fsStorage adapts a PocketBase filesystem to Storage. The content type is detected
+// from the data rather than taken from the caller.
+type fsStorage struct {
+	fs       *filesystem.System
+	baseURL  string
+	provider string // set for remote backends so failures are retried by the job queue
+}
+
+func (s *fsStorage) wrap(err error) error {
+	if s.provider == "" {
+		return err
+	}
+	return &ProviderError{Provider: s.provider, Err: err}
+}
+
+// Put spools r to a temp file first: the filesystem needs a seekable source to
+// detect the content type, and it keeps large files out of memory.
+func (s *fsStorage) Put(key string, r io.Reader, size int64, contentType string) (Object, error) {
+	tmp, err := os.CreateTemp("", "rivendell-*")
+	if err != nil {
+		return Object{}, fmt.Errorf("[Storage.Put][os.CreateTemp]: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return Object{}, fmt.Errorf("[Storage.Put][io.Copy]: %w", err)
+	}
+
+	file, err := filesystem.NewFileFromPath(tmp.Name())
+	if err != nil {
+		return Object{}, fmt.Errorf("[Storage.Put][NewFileFromPath]: %w", err)
+	}
+
+	if err := s.fs.UploadFile(file, key); err != nil {
+		return Object{}, s.wrap(fmt.Errorf("[Storage.Put]: %w", err))
+	}
+	return Object{Key: key, URL: s.PublicURL(key)}, nil
+}
+
+func (s *fsStorage) Get(key string) ([]byte, error) {
+	r, err := s.Open(key)
+	if err != nil {
+		return nil, fmt.Errorf("[Storage.Get]%w", err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, s.wrap(fmt.Errorf("[Storage.Get][io.ReadAll]: %w", err))
+	}
+	return data, nil
+}
+
+func (s *fsStorage) Open(key string) (io.ReadCloser, error) {
+	r, err := s.fs.GetReader(key)
+	if errors.Is(err, filesystem.ErrNotFound) {
+		return nil, fmt.Errorf("[Storage.Open]: %w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return nil, s.wrap(fmt.Errorf("[Storage.Open]: %w", err))
+	}
+	return r, nil
+}
+
+func (s *fsStorage) Delete(key string) error {
+	err := s.fs.Delete(key)
+	if err != nil && !errors.Is(err, filesystem.ErrNotFound) {
+		return s.wrap(fmt.Errorf("[Storage.Delete]: %w", err))
+	}
+	return nil
+}
+
+func (s *fsStorage) Exists(key string) (bool, error) {
+	ok, err := s.fs.Exists(key)
+	if err != nil {
+		return false, s.wrap(fmt.Errorf("[Storage.Exists]: %w", err))
+	}
+	return ok, nil
+}
+
+func (s *fsStorage) List(prefix string) ([]string, error) {
+	objects, err := s.fs.List(prefix)
+	if err != nil {
+		return nil, s.wrap(fmt.Errorf("[Storage.List]: %w", err))
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	return keys, nil
+}
+
+func (s *fsStorage) PublicURL(key string) string {
+	return fmt.Sprintf("%s/%s", s.baseURL, escapeKey(key))
+}
+
+// S3Storage stores objects in any S3-compatible bucket (B2's S3 endpoint, MinIO, R2).
+type S3Storage struct {
+	fsStorage
+}
+
+// NewS3Storage connects to the bucket configured by the S3_* keys. Public URLs are
+// built from S3_PUBLIC_URL, or {S3_ENDPOINT}/{S3_BUCKET} when it isn't set.
+func NewS3Storage() (*S3Storage, error) {
+	keys := map[string]string{}
+	for _, name := range []string{"S3_ENDPOINT", "S3_REGION", "S3_BUCKET", "S3_ACCESS_KEY", "S3_SECRET_KEY", "S3_FORCE_PATH_STYLE", "S3_PUBLIC_URL"} {
+		value, err := GetKeys(name)
+		if err != nil {
+			return nil, fmt.Errorf("[NewS3Storage]%w", err)
+		}
+		keys[name] = value
+	}
+
+	endpoint := strings.TrimSuffix(keys["S3_ENDPOINT"], "/")
+	if endpoint == "" || keys["S3_BUCKET"] == "" {
+		return nil, errors.New("[NewS3Storage]: S3_ENDPOINT and S3_BUCKET are required")
+	}
+
+	fs, err := filesystem.NewS3(
+		keys["S3_BUCKET"],
+		keys["S3_REGION"],
+		endpoint,
+		keys["S3_ACCESS_KEY"],
+		keys["S3_SECRET_KEY"],
+		keys["S3_FORCE_PATH_STYLE"] == "true",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[NewS3Storage][filesystem.NewS3]: %w", err)
+	}
+
+	baseURL := strings.TrimSuffix(keys["S3_PUBLIC_URL"], "/")
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("%s/%s", endpoint, keys["S3_BUCKET"])
+	}
+
+	return &S3Storage{fsStorage{fs: fs, baseURL: baseURL, provider: "s3"}}, nil
+}
+
+// LocalStorage stores objects on disk, for running offline in development and tests.
+type LocalStorage struct {
+	fsStorage
+	dir string
+}
+
+// Default location and URL of local storage; the URL matches the /storage route
+// main serves the directory on.
+const (
+	defaultLocalStorageDir = "pb_archive"
+	defaultLocalStorageURL = "http://127.0.0.1:8090/storage"
+)
+
+// NewLocalStorage stores objects under LOCAL_STORAGE_DIR, served from LOCAL_STORAGE_URL.
+func NewLocalStorage() (*LocalStorage, error) {
+	dir, err := GetKeys("LOCAL_STORAGE_DIR")
+	if err != nil {
+		return nil, fmt.Errorf("[NewLocalStorage]%w", err)
+	}
+	baseURL, err := GetKeys("LOCAL_STORAGE_URL")
+	if err != nil {
+		return nil, fmt.Errorf("[NewLocalStorage]%w", err)
+	}
+
+	if dir == "" {
+		dir = defaultLocalStorageDir
+	}
+	if baseURL == "" {
+		baseURL = defaultLocalStorageURL
+	}
+
+	return NewLocalStorageAt(dir, strings.TrimSuffix(baseURL, "/"))
+}
+
+// NewLocalStorageAt stores objects under dir, with public URLs rooted at baseURL.
+func NewLocalStorageAt(dir, baseURL string) (*LocalStorage, error) {
+	fs, err := filesystem.NewLocal(dir)
+	if err != nil {
+		return nil, fmt.Errorf("[NewLocalStorage][filesystem.NewLocal]: %w", err)
+	}
+	return &LocalStorage{fsStorage: fsStorage{fs: fs, baseURL: baseURL}, dir: dir}, nil
+}
+
+// Dir returns the directory objects are stored in.
+func (s *LocalStorage) Dir() string {
+	return s.dir
+}
@@ -0,0 +1,188 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// defaultB2PartSize is used when the authorization doesn't recommend a part size.
+const defaultB2PartSize = 100 * 1000 * 1000
+
+// b2PartSize picks the part size for an upload of size bytes (-1 when unknown):
+// the account's recommended size, or the whole file when it's smaller than that.
+func b2PartSize(recommended int, size int64) int {
+	if recommended <= 0 {
+		recommended = defaultB2PartSize
+	}
+	if size >= 0 && size < int64(recommended) {
+		return int(size)
+	}
+	return recommended
+}
+
+type b2PartUrl struct {
+	UploadUrl          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// b2Call runs a B2 API call with the cached authorization, re-authorizing once if
+// the token was rejected.
+func b2Call(endpoint string, payload any, result any) error {
+	return withB2Auth(func() error {
+		authData, err := getB2Auth()
+		if err != nil {
+			return err
+		}
+		return b2Post(authData, endpoint, payload, result)
+	})
+}
+
+// b2UploadLarge uploads first, a full part already read by the caller, followed by
+// the rest of r as a B2 large file in parts of len(first) bytes, and returns the
+// stored file. Only one part is held in memory at a time: first's buffer is reused
+// for every part. A failed upload is cancelled so its parts don't linger in the bucket.
+// DOCS: https://www.backblaze.com/b2/docs/large_files.html
+func b2UploadLarge(key string, first []byte, r io.Reader, contentType string) (b2File, error) {
+	bucketID, err := GetKeys("BUCKET_ID")
+	if err != nil {
+		return b2File{}, fmt.Errorf("[b2UploadLarge]%w", err)
+	}
+
+	if contentType == "" {
+		contentType = "b2/x-auto"
+	}
+
+	// DOCS: https://www.backblaze.com/b2/docs/b2_start_large_file.html
+	var file b2File
+	err = b2Call("b2_start_large_file", map[string]any{
+		"bucketId":    bucketID,
+		"fileName":    key,
+		"contentType": contentType,
+		"fileInfo":    map[string]string{"author": "rivendell"},
+	}, &file)
+	if err != nil {
+		return b2File{}, fmt.Errorf("[b2UploadLarge]%w", err)
+	}
+
+	sha1s, size, err := b2UploadParts(file.FileId, first, r)
+	if err == nil {
+		// DOCS: https://www.backblaze.com/b2/docs/b2_finish_large_file.html
+		err = b2Call("b2_finish_large_file", map[string]any{
+			"fileId":        file.FileId,
+			"partSha1Array": sha1s,
+		}, &file)
+	}
+	if err == nil {
+		// B2 checked each part's SHA1; the whole file only reports its length.
+		if err = verifyB2Upload("", file.ContentLength, "", size); err != nil {
+			err = &ProviderError{Provider: "b2", Err: err}
+		}
+	}
+	if err != nil {
+		// DOCS: https://www.backblaze.com/b2/docs/b2_cancel_large_file.html
+		if cancelErr := b2Call("b2_cancel_large_file", map[string]string{"fileId": file.FileId}, nil); cancelErr != nil {
+			log.Printf("[b2UploadLarge][b2_cancel_large_file]: %v", cancelErr)
+		}
+		return b2File{}, fmt.Errorf("[b2UploadLarge]%w", err)
+	}
+
+	return file, nil
+}
+
+// b2UploadParts uploads first as part 1 of fileId, then reads r into first's buffer
+// for each following part, returning the parts' SHA1s in order and the total bytes
+// sent.
+func b2UploadParts(fileId string, first []byte, r io.Reader) ([]string, int64, error) {
+	var (
+		partUrl b2PartUrl
+		sha1s   []string
+		size    int64
+		buf     = first
+		n       = len(first)
+		err     error
+	)
+
+	for partNumber := 1; ; partNumber++ {
+		if partNumber > 1 {
+			n, err = io.ReadFull(r, buf)
+			if err == io.EOF {
+				break
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return nil, 0, fmt.Errorf("[b2UploadParts][io.ReadFull]: %w", err)
+			}
+		}
+
+		part := buf[:n]
+		hash := fmt.Sprintf("%x", sha1.Sum(part))
+
+		// A part URL serves every part of the file; get a fresh one when its
+		// token is rejected.
+		err = withB2Auth(func() error {
+			if partUrl.UploadUrl == "" {
+				// DOCS: https://www.backblaze.com/b2/docs/b2_get_upload_part_url.html
+				if err := b2Call("b2_get_upload_part_url", map[string]string{"fileId": fileId}, &partUrl); err != nil {
+					return err
+				}
+			}
+			if err := b2UploadPart(partUrl, partNumber, part, hash); err != nil {
+				partUrl = b2PartUrl{}
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("[b2UploadParts] part %d: %w", partNumber, err)
+		}
+
+		sha1s = append(sha1s, hash)
+		size += int64(n)
+		if n < len(buf) {
+			break
+		}
+	}
+
+	return sha1s, size, nil
+}
+
+// b2UploadPart uploads one part of a large file and checks B2 stored it intact.
+// DOCS: https://www.backblaze.com/b2/docs/b2_upload_part.html
+func b2UploadPart(partUrl b2PartUrl, partNumber int, part []byte, hash string) error {
+	req, err := http.NewRequest("POST", partUrl.UploadUrl, bytes.NewReader(part))
+	if err != nil {
+		return fmt.Errorf("[b2UploadPart][http.NewRequest]: %w", err)
+	}
+
+	req.Header.Set("Authorization", partUrl.AuthorizationToken)
+	req.Header.Set("X-Bz-Part-Number", strconv.Itoa(partNumber))
+	req.Header.Set("Content-Length", strconv.Itoa(len(part)))
+	req.Header.Set("X-Bz-Content-Sha1", hash)
+
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return &ProviderError{Provider: "b2", Err: fmt.Errorf("[b2UploadPart][client.Do]: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return b2ResponseError("b2UploadPart", resp)
+	}
+
+	var stored struct {
+		ContentLength int64  `json:"contentLength"`
+		ContentSha1   string `json:"contentSha1"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stored); err != nil {
+		return fmt.Errorf("[b2UploadPart][json.NewDecoder]: %w", err)
+	}
+	if err := verifyB2Upload(stored.ContentSha1, stored.ContentLength, hash, int64(len(part))); err != nil {
+		return &ProviderError{Provider: "b2", Err: fmt.Errorf("[b2UploadPart]: %w", err)}
+	}
+	return nil
+}
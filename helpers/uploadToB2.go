@@ -5,10 +5,16 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	neturl "net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type B2AuthResp struct {
@@ -50,12 +56,56 @@ type B2UploadResp struct {
 	} `json:"serverSideEncryption"`
 }
 
+// ErrUploadMismatch is returned when B2 reports storing a different length or SHA1
+// than what was sent. The upload is retried by the job queue.
+var ErrUploadMismatch = errors.New("uploaded content doesn't match")
+
+// verifyB2Upload compares the length and SHA1 B2 reports storing with what was sent.
+// wantSha1 is "" when B2 doesn't report one (large files only report "none").
+func verifyB2Upload(gotSha1 string, gotLength int64, wantSha1 string, wantLength int64) error {
+	if gotLength != wantLength {
+		return fmt.Errorf("%w: stored %d bytes, sent %d", ErrUploadMismatch, gotLength, wantLength)
+	}
+	if wantSha1 != "" && !strings.EqualFold(gotSha1, wantSha1) {
+		return fmt.Errorf("%w: stored SHA1 %q, sent %q", ErrUploadMismatch, gotSha1, wantSha1)
+	}
+	return nil
+}
+
 type B2Error struct {
 	Status  int    `json:"status"`
 	Code    string `json:"code"`
 	Message string `json:"message"`
 }
 
+func (e *B2Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d - %s", e.Status, e.Code)
+	}
+	return e.Message
+}
+
+// b2ResponseError turns a non-2xx B2 response into a ProviderError wrapping B2's
+// error body.
+func b2ResponseError(caller string, resp *http.Response) error {
+	var b2Error B2Error
+	if err := json.NewDecoder(resp.Body).Decode(&b2Error); err != nil {
+		return newProviderError("b2", resp, fmt.Errorf("[%s][b2Error]: %s", caller, resp.Status))
+	}
+	return newProviderError("b2", resp, fmt.Errorf("[%s][b2Error]: %w", caller, &b2Error))
+}
+
+// isB2AuthError reports whether B2 rejected the authorization token itself, which a
+// fresh authorization fixes. Bodiless 401s (e.g. HEAD requests) count too.
+func isB2AuthError(err error) bool {
+	var b2Error *B2Error
+	if errors.As(err, &b2Error) {
+		return b2Error.Code == "expired_auth_token" || b2Error.Code == "bad_auth_token"
+	}
+	pErr, ok := AsProviderError(err)
+	return ok && pErr.StatusCode == http.StatusUnauthorized
+}
+
 type B2AuthTokens struct {
 	ApiUrl              string
 	AuthorizationToken  string
@@ -67,18 +117,89 @@ type B2UploadTokens struct {
 	Endpoint    string
 	AuthToken   string
 	DownloadUrl string
+	Expires     time.Time
+}
+
+// Account authorizations and upload URLs are both valid for 24h; they're refreshed
+// an hour early.
+const b2TokenTTL = 23 * time.Hour
+
+// b2Auth is cached in memory across uploads. Upload URLs are pooled: each may only be
+// used by one upload at a time, so an upload takes one out and puts it back when done.
+var (
+	b2AuthMu  sync.Mutex
+	b2Auth    B2AuthTokens
+	b2AuthExp time.Time
+
+	b2UploadMu   sync.Mutex
+	b2UploadPool []B2UploadTokens
+)
+
+// getB2Auth returns the cached account authorization, authorizing when there's none
+// or it has expired.
+func getB2Auth() (B2AuthTokens, error) {
+	b2AuthMu.Lock()
+	defer b2AuthMu.Unlock()
+
+	if b2Auth.AuthorizationToken != "" && time.Now().Before(b2AuthExp) {
+		return b2Auth, nil
+	}
+
+	authData, err := AuthTokens()
+	if err != nil {
+		return B2AuthTokens{}, fmt.Errorf("[getB2Auth]%w", err)
+	}
+
+	b2Auth = authData
+	b2AuthExp = time.Now().Add(b2TokenTTL)
+	return b2Auth, nil
+}
+
+// invalidateB2Auth drops the cached authorization and every pooled upload URL.
+func invalidateB2Auth() {
+	b2AuthMu.Lock()
+	b2Auth = B2AuthTokens{}
+	b2AuthExp = time.Time{}
+	b2AuthMu.Unlock()
+
+	b2UploadMu.Lock()
+	b2UploadPool = nil
+	b2UploadMu.Unlock()
+}
+
+// acquireUploadUrl takes an unexpired upload URL from the pool, or requests a new one.
+func acquireUploadUrl() (B2UploadTokens, error) {
+	b2UploadMu.Lock()
+	for len(b2UploadPool) > 0 {
+		upload := b2UploadPool[len(b2UploadPool)-1]
+		b2UploadPool = b2UploadPool[:len(b2UploadPool)-1]
+		if time.Now().Before(upload.Expires) {
+			b2UploadMu.Unlock()
+			return upload, nil
+		}
+	}
+	b2UploadMu.Unlock()
+
+	return GetUploadUrl()
 }
 
-// pathMap maps collection names to their B2 folder names.
-var pathMap = map[string]string{
-	"bookmarks": "Bookmarks",
-	"books":     "Books",
-	"cds":       "CDs",
-	"games":     "Games",
-	"movies":    "Movies",
-	"mtg":       "MTG",
-	"shows":     "Shows",
-	"vinyls":    "Vinyls",
+// releaseUploadUrl returns an upload URL to the pool after a successful upload. URLs
+// from failed uploads are dropped instead, as B2 asks.
+func releaseUploadUrl(upload B2UploadTokens) {
+	b2UploadMu.Lock()
+	defer b2UploadMu.Unlock()
+	b2UploadPool = append(b2UploadPool, upload)
+}
+
+// withB2Auth runs fn, and runs it once more after re-authorizing when B2 rejected an
+// expired or bad token.
+func withB2Auth(fn func() error) error {
+	err := fn()
+	if err != nil && isB2AuthError(err) {
+		invalidateB2Auth()
+		err = fn()
+	}
+	return err
 }
 
 // Authorize B2 bucket for upload.
@@ -105,23 +226,13 @@ func AuthTokens() (B2AuthTokens, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return B2AuthTokens{}, fmt.Errorf("[AuthTokens][client.Do]: %w", err)
+		return B2AuthTokens{}, &ProviderError{Provider: "b2", Err: fmt.Errorf("[AuthTokens][client.Do]: %w", err)}
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		var b2Error B2Error
-		err := json.NewDecoder(resp.Body).Decode(&b2Error)
-		if err != nil {
-			return B2AuthTokens{}, fmt.Errorf("[AuthTokens][json.NewDecoder](b2Error): %w", err)
-		}
-
-		msg := b2Error.Message
-		if msg == "" {
-			msg = fmt.Sprintf("%d - %s", b2Error.Status, b2Error.Code)
-		}
-		return B2AuthTokens{}, fmt.Errorf("[AuthTokens][b2Error]: %s", msg)
+		return B2AuthTokens{}, b2ResponseError("AuthTokens", resp)
 	}
 
 	var results B2AuthResp
@@ -143,7 +254,7 @@ func AuthTokens() (B2AuthTokens, error) {
 // Get B2 endpoint for upload.
 // DOCS: https://www.backblaze.com/b2/docs/b2_get_upload_url.html
 func GetUploadUrl() (B2UploadTokens, error) {
-	authData, err := AuthTokens()
+	authData, err := getB2Auth()
 	if err != nil {
 		return B2UploadTokens{}, fmt.Errorf("[GetUploadUrl]%w", err)
 	}
@@ -167,23 +278,13 @@ func GetUploadUrl() (B2UploadTokens, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return B2UploadTokens{}, fmt.Errorf("[GetUploadUrl][client.Do]: %w", err)
+		return B2UploadTokens{}, &ProviderError{Provider: "b2", Err: fmt.Errorf("[GetUploadUrl][client.Do]: %w", err)}
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		var b2Error B2Error
-		err := json.NewDecoder(resp.Body).Decode(&b2Error)
-		if err != nil {
-			return B2UploadTokens{}, fmt.Errorf("[GetUploadUrl][json.NewDecoder](b2Error): %w", err)
-		}
-
-		msg := b2Error.Message
-		if msg == "" {
-			msg = fmt.Sprintf("%d - %s", b2Error.Status, b2Error.Code)
-		}
-		return B2UploadTokens{}, fmt.Errorf("[GetUploadUrl][b2Error]: %s", msg)
+		return B2UploadTokens{}, b2ResponseError("GetUploadUrl", resp)
 	}
 
 	var results B2UpUrlResp
@@ -196,44 +297,125 @@ func GetUploadUrl() (B2UploadTokens, error) {
 		Endpoint:    results.UploadUrl,
 		AuthToken:   results.AuthorizationToken,
 		DownloadUrl: authData.DownloadUrl,
+		Expires:     time.Now().Add(b2TokenTTL),
 	}
 
 	return uploadTokens, nil
 }
 
-// Upload file to B2 bucket.
-// collection is the PocketBase collection name (e.g. "books") — looked up in pathMap to
-// determine the B2 subfolder. filename is the path within that folder (e.g. "cover.jpeg").
-// Full B2 path: PocketBase/{folder}/{filename}
-// DOCS: https://www.backblaze.com/b2/docs/b2_upload_file.html
-func UploadToB2(data []byte, collection, filename, fileType string) (string, error) {
-	authData, err := GetUploadUrl()
+// b2File is a file version as returned by the upload, large-file and listing calls.
+type b2File struct {
+	FileId        string `json:"fileId"`
+	FileName      string `json:"fileName"`
+	Action        string `json:"action"`
+	ContentLength int64  `json:"contentLength"`
+}
+
+type b2FileList struct {
+	Files        []b2File `json:"files"`
+	NextFileName *string  `json:"nextFileName"`
+}
+
+// B2Storage stores objects in a B2 bucket through the native B2 API. Authorization
+// and upload URLs are cached across calls (see getB2Auth).
+type B2Storage struct {
+	bucketName string
+	private    bool
+}
+
+func NewB2Storage() (*B2Storage, error) {
+	bucketName, err := GetKeys("BUCKET_NAME")
 	if err != nil {
-		return "", fmt.Errorf("[UploadToB2]%w", err)
+		return nil, fmt.Errorf("[NewB2Storage]%w", err)
 	}
+	private, err := GetKeys("BUCKET_PRIVATE")
+	if err != nil {
+		return nil, fmt.Errorf("[NewB2Storage]%w", err)
+	}
+	return &B2Storage{bucketName: bucketName, private: private == "true"}, nil
+}
+
+// Put streams r under key and returns its public URL. Anything up to the account's
+// recommended part size goes up in a single request; larger files are sent as a
+// multipart large file, one part in memory at a time.
+func (b *B2Storage) Put(key string, r io.Reader, size int64, contentType string) (Object, error) {
+	authData, err := getB2Auth()
+	if err != nil {
+		return Object{}, fmt.Errorf("[B2Storage.Put]%w", err)
+	}
+
+	partSize := b2PartSize(authData.RecommendedPartSize, size)
 
-	folder, ok := pathMap[collection]
-	if !ok {
-		folder = collection
+	// Read one part's worth, then one byte more: if the reader ends within the part,
+	// it's a small file. A large file reuses the part's buffer for every part.
+	part := make([]byte, partSize)
+	n, err := io.ReadFull(r, part)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return Object{}, fmt.Errorf("[B2Storage.Put][io.ReadFull]: %w", err)
+	}
+	var next [1]byte
+	var more int
+	if n == partSize {
+		more, err = io.ReadFull(r, next[:])
+		if err != nil && err != io.EOF {
+			return Object{}, fmt.Errorf("[B2Storage.Put][io.ReadFull]: %w", err)
+		}
+	}
+
+	var file b2File
+	if more == 0 {
+		file, err = b2UploadSmall(key, part[:n], contentType)
+	} else {
+		file, err = b2UploadLarge(key, part, io.MultiReader(bytes.NewReader(next[:]), r), contentType)
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("[B2Storage.Put]%w", err)
 	}
-	name := fmt.Sprintf("PocketBase/%s/%s", folder, filename)
 
+	log.Printf("[B2Storage.Put]: Uploaded '%s'.\n", file.FileName)
+
+	return Object{Key: file.FileName, URL: b.PublicURL(file.FileName), FileID: file.FileId}, nil
+}
+
+// b2UploadSmall uploads data in a single request through a pooled upload URL.
+func b2UploadSmall(key string, data []byte, contentType string) (b2File, error) {
+	var file b2File
+	err := withB2Auth(func() error {
+		upload, err := acquireUploadUrl()
+		if err != nil {
+			return err
+		}
+
+		file, err = b2Upload(upload, key, data, contentType)
+		if err != nil {
+			return err
+		}
+
+		releaseUploadUrl(upload)
+		return nil
+	})
+	return file, err
+}
+
+// b2Upload uploads data through an upload URL and returns the stored file.
+// DOCS: https://www.backblaze.com/b2/docs/b2_upload_file.html
+func b2Upload(upload B2UploadTokens, key string, data []byte, contentType string) (b2File, error) {
 	hasher := sha1.New()
 	hasher.Write(data)
 	hash := fmt.Sprintf("%x", hasher.Sum(nil))
 
-	if fileType == "" {
-		fileType = "b2/x-auto"
+	if contentType == "" {
+		contentType = "b2/x-auto"
 	}
 
-	req, err := http.NewRequest("POST", authData.Endpoint, bytes.NewReader(data))
+	req, err := http.NewRequest("POST", upload.Endpoint, bytes.NewReader(data))
 	if err != nil {
-		return "", fmt.Errorf("[UploadToB2][http.NewRequest]: %w", err)
+		return b2File{}, fmt.Errorf("[b2Upload][http.NewRequest]: %w", err)
 	}
 
-	req.Header.Set("Authorization", authData.AuthToken)
-	req.Header.Set("X-Bz-File-Name", name)
-	req.Header.Set("Content-Type", fileType)
+	req.Header.Set("Authorization", upload.AuthToken)
+	req.Header.Set("X-Bz-File-Name", escapeKey(key))
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Content-Length", strconv.Itoa(len(data)))
 	req.Header.Set("X-Bz-Content-Sha1", hash)
 	req.Header.Set("X-Bz-Info-Author", "rivendell")
@@ -241,38 +423,287 @@ func UploadToB2(data []byte, collection, filename, fileType string) (string, err
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("[UploadToB2][client.Do]: %w", err)
+		return b2File{}, &ProviderError{Provider: "b2", Err: fmt.Errorf("[b2Upload][client.Do]: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return b2File{}, b2ResponseError("b2Upload", resp)
+	}
+
+	var results B2UploadResp
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	if err != nil {
+		return b2File{}, fmt.Errorf("[b2Upload][json.NewDecoder](results): %w", err)
+	}
+
+	if err := verifyB2Upload(results.ContentSha1, int64(results.ContentLength), hash, int64(len(data))); err != nil {
+		// Don't leave a corrupt version behind to be served; the retry uploads a new one.
+		deleteErr := b2Call("b2_delete_file_version", map[string]string{"fileName": results.FileName, "fileId": results.FileId}, nil)
+		if deleteErr != nil {
+			log.Printf("[b2Upload][b2_delete_file_version]: %v", deleteErr)
+		}
+		return b2File{}, &ProviderError{Provider: "b2", Err: fmt.Errorf("[b2Upload] %s: %w", key, err)}
+	}
+
+	return b2File{FileId: results.FileId, FileName: results.FileName, ContentLength: int64(results.ContentLength)}, nil
+}
+
+// download requests key from the bucket's download endpoint with the given method.
+// DOCS: https://www.backblaze.com/b2/docs/b2_download_file_by_name.html
+// A 401 is returned as an error (after one re-authorization) so callers only see
+// authorized responses.
+func (b *B2Storage) download(method, key string) (*http.Response, error) {
+	var resp *http.Response
+	err := withB2Auth(func() error {
+		authData, err := getB2Auth()
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest(method, b.PublicURL(key), nil)
+		if err != nil {
+			return fmt.Errorf("[http.NewRequest]: %w", err)
+		}
+		req.Header.Set("Authorization", authData.AuthorizationToken)
+
+		resp, err = (&http.Client{}).Do(req)
+		if err != nil {
+			return &ProviderError{Provider: "b2", Err: fmt.Errorf("[client.Do]: %w", err)}
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			defer resp.Body.Close()
+			return b2ResponseError("download", resp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Get downloads the object stored under key.
+func (b *B2Storage) Get(key string) ([]byte, error) {
+	body, err := b.Open(key)
+	if err != nil {
+		return nil, fmt.Errorf("[B2Storage.Get]%w", err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("[B2Storage.Get][io.ReadAll]: %w", err)
+	}
+	return data, nil
+}
+
+// Open streams the object stored under key.
+func (b *B2Storage) Open(key string) (io.ReadCloser, error) {
+	resp, err := b.download("GET", key)
+	if err != nil {
+		return nil, fmt.Errorf("[B2Storage.Open]%w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("[B2Storage.Open]: %w: %s", ErrObjectNotFound, key)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, b2ResponseError("B2Storage.Open", resp)
+	}
+	return resp.Body, nil
+}
+
+// Exists reports whether an object is stored under key.
+func (b *B2Storage) Exists(key string) (bool, error) {
+	resp, err := b.download("HEAD", key)
+	if err != nil {
+		return false, fmt.Errorf("[B2Storage.Exists]%w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, newProviderError("b2", resp, fmt.Errorf("[B2Storage.Exists]: %s", resp.Status))
+}
+
+// b2Post calls a B2 API endpoint with a JSON payload and decodes the JSON response.
+func b2Post(authData B2AuthTokens, endpoint string, payload any, result any) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("[b2Post][json.Marshal]: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/b2api/v2/%s", authData.ApiUrl, endpoint), bytes.NewReader(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("[b2Post][http.NewRequest]: %w", err)
+	}
+	req.Header.Set("Authorization", authData.AuthorizationToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return &ProviderError{Provider: "b2", Err: fmt.Errorf("[b2Post][client.Do]: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		var b2Error B2Error
-		err := json.NewDecoder(resp.Body).Decode(&b2Error)
+		return b2ResponseError("b2Post "+endpoint, resp)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("[b2Post][json.NewDecoder]: %w", err)
+	}
+	return nil
+}
+
+// Delete removes every version of the object stored under key. Deleting a missing
+// object is not an error.
+// DOCS: https://www.backblaze.com/b2/docs/b2_list_file_versions.html
+// DOCS: https://www.backblaze.com/b2/docs/b2_delete_file_version.html
+func (b *B2Storage) Delete(key string) error {
+	bucketID, err := GetKeys("BUCKET_ID")
+	if err != nil {
+		return fmt.Errorf("[B2Storage.Delete]%w", err)
+	}
+
+	err = withB2Auth(func() error {
+		authData, err := getB2Auth()
+		if err != nil {
+			return err
+		}
+
+		var versions b2FileList
+		err = b2Post(authData, "b2_list_file_versions", map[string]any{
+			"bucketId":      bucketID,
+			"startFileName": key,
+			"prefix":        key,
+			"maxFileCount":  100,
+		}, &versions)
 		if err != nil {
-			return "", fmt.Errorf("[UploadToB2][json.NewDecoder](b2Error): %w", err)
+			return err
 		}
 
-		msg := b2Error.Message
-		if msg == "" {
-			msg = fmt.Sprintf("%d - %s", b2Error.Status, b2Error.Code)
+		for _, file := range versions.Files {
+			if file.FileName != key {
+				continue
+			}
+			err := b2Post(authData, "b2_delete_file_version", map[string]string{
+				"fileName": file.FileName,
+				"fileId":   file.FileId,
+			}, nil)
+			if err != nil {
+				return err
+			}
 		}
-		return "", fmt.Errorf("[UploadToB2][b2Error]: %s", msg)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("[B2Storage.Delete]%w", err)
 	}
+	return nil
+}
 
-	var results B2UploadResp
-	err = json.NewDecoder(resp.Body).Decode(&results)
+// DeleteVersion removes one file version by its B2 file ID, as recorded by Put,
+// without listing the bucket first.
+// DOCS: https://www.backblaze.com/b2/docs/b2_delete_file_version.html
+func (b *B2Storage) DeleteVersion(key, fileID string) error {
+	err := b2Call("b2_delete_file_version", map[string]string{
+		"fileName": key,
+		"fileId":   fileID,
+	}, nil)
+	var b2Err *B2Error
+	if errors.As(err, &b2Err) && b2Err.Status == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("[B2Storage.DeleteVersion]%w", err)
+	}
+	return nil
+}
+
+// List returns the keys of every file under prefix, following B2's pagination.
+// DOCS: https://www.backblaze.com/b2/docs/b2_list_file_names.html
+func (b *B2Storage) List(prefix string) ([]string, error) {
+	bucketID, err := GetKeys("BUCKET_ID")
 	if err != nil {
-		return "", fmt.Errorf("[UploadToB2][json.NewDecoder](results): %w", err)
+		return nil, fmt.Errorf("[B2Storage.List]%w", err)
 	}
 
-	bucketName, err := GetKeys("BUCKET_NAME")
+	var (
+		keys  []string
+		start = prefix
+	)
+	for {
+		var page b2FileList
+		err := b2Call("b2_list_file_names", map[string]any{
+			"bucketId":      bucketID,
+			"prefix":        prefix,
+			"startFileName": start,
+			"maxFileCount":  1000,
+		}, &page)
+		if err != nil {
+			return nil, fmt.Errorf("[B2Storage.List]%w", err)
+		}
+
+		for _, file := range page.Files {
+			if file.Action == "upload" {
+				keys = append(keys, file.FileName)
+			}
+		}
+
+		if page.NextFileName == nil {
+			return keys, nil
+		}
+		start = *page.NextFileName
+	}
+}
+
+// Private reports whether B2_BUCKET_PRIVATE is set, i.e. downloads need a signed URL.
+func (b *B2Storage) Private() bool {
+	return b.private
+}
+
+// SignedURL returns a download URL for key carrying a download authorization limited
+// to that file and ttl, so it works on a private bucket.
+// DOCS: https://www.backblaze.com/b2/docs/b2_get_download_authorization.html
+func (b *B2Storage) SignedURL(key string, ttl time.Duration) (string, error) {
+	bucketID, err := GetKeys("BUCKET_ID")
 	if err != nil {
-		return "", fmt.Errorf("[UploadToB2]%w", err)
+		return "", fmt.Errorf("[B2Storage.SignedURL]%w", err)
 	}
 
-	log.Printf("[UploadToB2]: Uploaded '%s'.\n", results.FileName)
+	var auth struct {
+		AuthorizationToken string `json:"authorizationToken"`
+	}
+	err = b2Call("b2_get_download_authorization", map[string]any{
+		"bucketId":               bucketID,
+		"fileNamePrefix":         key,
+		"validDurationInSeconds": int(ttl.Seconds()),
+	}, &auth)
+	if err != nil {
+		return "", fmt.Errorf("[B2Storage.SignedURL]%w", err)
+	}
 
-	publicURL := fmt.Sprintf("%s/file/%s/%s", authData.DownloadUrl, bucketName, results.FileName)
+	return fmt.Sprintf("%s?Authorization=%s", b.PublicURL(key), neturl.QueryEscape(auth.AuthorizationToken)), nil
+}
 
-	return publicURL, nil
+// PublicURL returns the bucket's download URL for key. Returns "" if the account
+// can't be authorized to learn its download host.
+func (b *B2Storage) PublicURL(key string) string {
+	authData, err := getB2Auth()
+	if err != nil {
+		log.Printf("[B2Storage.PublicURL]: %v", err)
+		return ""
+	}
+	return fmt.Sprintf("%s/file/%s/%s", authData.DownloadUrl, b.bucketName, escapeKey(key))
 }
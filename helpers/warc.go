@@ -0,0 +1,215 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	query "github.com/PuerkitoBio/goquery"
+)
+
+// WARC captures are capped so a page with hundreds of images doesn't turn into a
+// multi-gigabyte archive. Subresources over a limit are left out; the page itself
+// must fit.
+const (
+	warcMaxResources     = 100
+	warcMaxResourceBytes = 20 << 20
+	warcMaxBytes         = 100 << 20
+	warcTimeout          = 30 * time.Second
+)
+
+// warcSubresources are the elements whose URLs a page needs to render.
+var warcSubresources = []struct{ selector, attr string }{
+	{"link[rel~='stylesheet'][href]", "href"},
+	{"link[rel~='icon'][href]", "href"},
+	{"script[src]", "src"},
+	{"img[src]", "src"},
+	{"source[src]", "src"},
+	{"video[poster]", "poster"},
+}
+
+// warcWriter writes WARC/1.1 records.
+// DOCS: https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/
+type warcWriter struct {
+	w    io.Writer
+	date string
+}
+
+// writeRecord writes one record. Content-Length and the block digest are computed here.
+func (ww *warcWriter) writeRecord(warcType, id string, headers [][2]string, contentType string, block []byte) error {
+	var buf bytes.Buffer
+	buf.WriteString("WARC/1.1\r\n")
+	fmt.Fprintf(&buf, "WARC-Type: %s\r\n", warcType)
+	fmt.Fprintf(&buf, "WARC-Record-ID: %s\r\n", id)
+	fmt.Fprintf(&buf, "WARC-Date: %s\r\n", ww.date)
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+	fmt.Fprintf(&buf, "WARC-Block-Digest: %s\r\n", warcDigest(block))
+	fmt.Fprintf(&buf, "Content-Type: %s\r\n", contentType)
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(block))
+	buf.Write(block)
+	buf.WriteString("\r\n\r\n")
+
+	if _, err := ww.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("[writeRecord]: %w", err)
+	}
+	return nil
+}
+
+// warcDigest is the labelled base32 SHA-1 WARC uses for block and payload digests.
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// warcRecordID returns a fresh urn:uuid (version 4) record ID.
+func warcRecordID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// capture fetches target and writes its request and response records. Returns the
+// response body for the caller to look into, or an error when it couldn't be fetched
+// or is larger than max bytes.
+func (ww *warcWriter) capture(client *http.Client, target string, max int64) (*http.Response, []byte, error) {
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[capture][http.NewRequest]: %w", err)
+	}
+	req.Header.Set("User-Agent", "Rivendell/1.0")
+	// Keep the payload as sent, without transport compression, so it replays as is.
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[capture][client.Do]: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("[capture][io.ReadAll]: %w", err)
+	}
+	if int64(len(body)) > max {
+		return nil, nil, fmt.Errorf("[capture]: %s is larger than %d bytes", target, max)
+	}
+
+	// Redirects are followed; the records describe the request that got the response.
+	finalURL := resp.Request.URL.String()
+
+	var request bytes.Buffer
+	if err := resp.Request.Write(&request); err != nil {
+		return nil, nil, fmt.Errorf("[capture][Request.Write]: %w", err)
+	}
+
+	var response bytes.Buffer
+	fmt.Fprintf(&response, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+	header := resp.Header.Clone()
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Write(&response)
+	response.WriteString("\r\n")
+	response.Write(body)
+
+	responseID := warcRecordID()
+	err = ww.writeRecord("request", warcRecordID(), [][2]string{
+		{"WARC-Target-URI", finalURL},
+		{"WARC-Concurrent-To", responseID},
+	}, "application/http;msgtype=request", request.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("[capture]%w", err)
+	}
+	err = ww.writeRecord("response", responseID, [][2]string{
+		{"WARC-Target-URI", finalURL},
+		{"WARC-Payload-Digest", warcDigest(body)},
+	}, "application/http;msgtype=response", response.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("[capture]%w", err)
+	}
+
+	return resp, body, nil
+}
+
+// warcLinks returns the absolute http(s) URLs of a page's subresources, deduplicated
+// and in document order.
+func warcLinks(base *url.URL, body []byte) []string {
+	doc, err := query.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	var (
+		links []string
+		seen  = map[string]bool{base.String(): true}
+	)
+	for _, sub := range warcSubresources {
+		doc.Find(sub.selector).Each(func(_ int, s *query.Selection) {
+			ref, err := base.Parse(strings.TrimSpace(s.AttrOr(sub.attr, "")))
+			if err != nil || (ref.Scheme != "http" && ref.Scheme != "https") {
+				return
+			}
+			ref.Fragment = ""
+			if link := ref.String(); !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		})
+	}
+	return links
+}
+
+// CaptureWARC writes a WARC of pageURL and the stylesheets, scripts, icons and images
+// it references to w. Subresources that fail or exceed the limits are left out and
+// logged; the page itself must answer 200. Styles' own imports and fonts aren't
+// followed.
+func CaptureWARC(w io.Writer, pageURL string) error {
+	ww := &warcWriter{w: w, date: time.Now().UTC().Format(time.RFC3339)}
+	client := &http.Client{Timeout: warcTimeout}
+
+	info := "software: rivendell\r\nformat: WARC File Format 1.1\r\n"
+	if err := ww.writeRecord("warcinfo", warcRecordID(), nil, "application/warc-fields", []byte(info)); err != nil {
+		return fmt.Errorf("[CaptureWARC]%w", err)
+	}
+
+	resp, body, err := ww.capture(client, pageURL, warcMaxResourceBytes)
+	if err != nil {
+		return fmt.Errorf("[CaptureWARC]%w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("[CaptureWARC]: %s answered %s", pageURL, resp.Status)
+	}
+
+	total := int64(len(body))
+	links := warcLinks(resp.Request.URL, body)
+	if len(links) > warcMaxResources {
+		log.Printf("[CaptureWARC] %s: keeping %d of %d subresources", pageURL, warcMaxResources, len(links))
+		links = links[:warcMaxResources]
+	}
+	for _, link := range links {
+		limit := min(int64(warcMaxResourceBytes), warcMaxBytes-total)
+		if limit <= 0 {
+			log.Printf("[CaptureWARC] %s: %d byte limit reached", pageURL, warcMaxBytes)
+			break
+		}
+		_, sub, err := ww.capture(client, link, limit)
+		if err != nil {
+			log.Printf("[CaptureWARC] %s: %v", pageURL, err)
+			continue
+		}
+		total += int64(len(sub))
+	}
+
+	return nil
+}
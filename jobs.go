@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fourjuaneight/rivendell/helpers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Job statuses stored in the _jobs collection. "failed" jobs are waiting for a retry;
+// "dead" jobs have permanently failed and are only picked up again once re-driven.
+const (
+	jobPending = "pending"
+	jobRunning = "running"
+	jobFailed  = "failed"
+	jobDead    = "dead"
+	jobDone    = "done"
+)
+
+const (
+	jobsCollection  = "_jobs"
+	jobWorkers      = 2
+	jobPollInterval = 5 * time.Second
+
+	// Finished jobs are kept for a week so recent outcomes can still be inspected.
+	jobRetention     = 7 * 24 * time.Hour
+	jobPruneSchedule = "30 3 * * *"
+)
+
+// jobQueue runs enrichers in the background from jobs persisted in the _jobs collection.
+// Jobs survive restarts: anything left "running" by a previous process is reset to
+// "pending" on start and picked up again.
+type jobQueue struct {
+	app       core.App
+	enrichers *Registry
+
+	claimMu sync.Mutex // serializes pending → running transitions across workers
+	wake    chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newJobQueue(app core.App, enrichers *Registry) *jobQueue {
+	return &jobQueue{
+		app:       app,
+		enrichers: enrichers,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// enqueue persists a pending job for the record and nudges an idle worker.
+// preserve lists fields the enricher must not overwrite (e.g. fields the caller
+// edited by hand in the same update request).
+func (q *jobQueue) enqueue(collection, recordID string, preserve []string) error {
+	jobs, err := q.app.FindCollectionByNameOrId(jobsCollection)
+	if err != nil {
+		return fmt.Errorf("[enqueue][FindCollectionByNameOrId]: %w", err)
+	}
+
+	job := core.NewRecord(jobs)
+	job.Set("collection", collection)
+	job.Set("record", recordID)
+	job.Set("status", jobPending)
+	job.Set("attempts", 0)
+	job.Set("run_after", types.NowDateTime())
+	job.Set("preserve", preserve)
+	if err := q.app.Save(job); err != nil {
+		return fmt.Errorf("[enqueue][save]: %w", err)
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// start resumes interrupted jobs and launches the worker goroutines.
+func (q *jobQueue) start() error {
+	_, err := q.app.DB().Update(
+		jobsCollection,
+		dbx.Params{"status": jobPending},
+		dbx.HashExp{"status": jobRunning},
+	).Execute()
+	if err != nil {
+		return fmt.Errorf("[jobQueue.start][resume]: %w", err)
+	}
+
+	if err := q.prune(); err != nil {
+		return fmt.Errorf("[jobQueue.start]%w", err)
+	}
+	err = q.app.Cron().Add("pruneJobs", jobPruneSchedule, func() {
+		if err := q.prune(); err != nil {
+			log.Printf("[jobQueue.prune]: %v", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("[jobQueue.start][cron]: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+
+	for range jobWorkers {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	return nil
+}
+
+// stop signals the workers to exit and waits for in-flight jobs to finish.
+func (q *jobQueue) stop() {
+	if q.cancel == nil {
+		return
+	}
+	q.cancel()
+	q.wg.Wait()
+}
+
+// prune deletes done jobs last updated more than jobRetention ago. Failed and dead
+// jobs are kept until they're re-driven or cleared by hand.
+func (q *jobQueue) prune() error {
+	before := types.NowDateTime().Add(-jobRetention).String()
+	_, err := q.app.DB().Delete(
+		jobsCollection,
+		dbx.And(
+			dbx.HashExp{"status": jobDone},
+			dbx.NewExp("updated < {:before}", dbx.Params{"before": before}),
+		),
+	).Execute()
+	if err != nil {
+		return fmt.Errorf("[prune]: %w", err)
+	}
+	return nil
+}
+
+func (q *jobQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before going back to sleep.
+		for ctx.Err() == nil {
+			job, err := q.claim()
+			if err != nil {
+				log.Printf("[jobQueue.work][claim]: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			q.run(job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim marks the oldest due job as running and returns it, or nil when nothing is due.
+func (q *jobQueue) claim() (*core.Record, error) {
+	q.claimMu.Lock()
+	defer q.claimMu.Unlock()
+
+	jobs, err := q.app.FindRecordsByFilter(
+		jobsCollection,
+		"(status = {:pending} || status = {:failed}) && run_after <= {:now}",
+		"run_after",
+		1, 0,
+		dbx.Params{"pending": jobPending, "failed": jobFailed, "now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[claim][FindRecordsByFilter]: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	job := jobs[0]
+	job.Set("status", jobRunning)
+	job.Set("attempts", job.GetInt("attempts")+1)
+	if err := q.app.Save(job); err != nil {
+		return nil, fmt.Errorf("[claim][save]: %w", err)
+	}
+	return job, nil
+}
+
+// run executes the enricher for a claimed job and records the outcome on the job.
+func (q *jobQueue) run(job *core.Record) {
+	var preserve []string
+	if err := job.UnmarshalJSONField("preserve", &preserve); err != nil {
+		log.Printf("[jobQueue.run][preserve]: %v", err)
+	}
+
+	if err := q.enrich(job.GetString("collection"), job.GetString("record"), preserve); err != nil {
+		log.Printf("[jobQueue.run] %s/%s: %v", job.GetString("collection"), job.GetString("record"), err)
+		q.fail(job, err)
+	} else {
+		job.Set("status", jobDone)
+		job.Set("last_error", "")
+	}
+
+	if err := q.app.Save(job); err != nil {
+		log.Printf("[jobQueue.run][save]: %v", err)
+	}
+}
+
+// fail records a failed attempt on the job. Transient provider errors (429s, 5xx,
+// timeouts) are rescheduled with backoff until the provider's retry budget runs out;
+// anything else is dead-lettered straight away.
+func (q *jobQueue) fail(job *core.Record, err error) {
+	job.Set("last_error", err.Error())
+
+	pErr, ok := helpers.AsProviderError(err)
+	if !ok {
+		job.Set("status", jobDead)
+		return
+	}
+	job.Set("provider", pErr.Provider)
+
+	policy := helpers.GetRetryPolicy(pErr.Provider)
+	attempts := job.GetInt("attempts")
+	if !pErr.Transient() || attempts >= policy.MaxAttempts {
+		job.Set("status", jobDead)
+		return
+	}
+
+	delay := policy.Backoff(attempts, rand.Float64(), pErr.RetryAfter)
+	job.Set("status", jobFailed)
+	job.Set("run_after", types.NowDateTime().Add(delay))
+}
+
+// enrich runs the record's collection enricher against its current version; fields
+// listed in preserve are left as they are.
+func (q *jobQueue) enrich(collection, recordID string, preserve []string) error {
+	if !q.enrichers.Has(collection) {
+		return fmt.Errorf("[enrich]: no enricher for %q", collection)
+	}
+
+	record, err := q.app.FindRecordById(collection, recordID)
+	if err != nil {
+		return fmt.Errorf("[enrich][FindRecordById]: %w", err)
+	}
+
+	if _, err := applyEnricher(q.app, q.enrichers.Enrich, record, preserve...); err != nil {
+		return fmt.Errorf("[enrich]%w", err)
+	}
+	return nil
+}
+
+// applyEnricher runs an enricher against a record and saves the fields it changed.
+// Enrichers can take a while, so the changes are written onto a fresh copy of the
+// record inside a transaction: edits saved in the meantime to other fields are kept.
+// Fields listed in preserve are never written. Reports whether the record was saved.
+func applyEnricher(app core.App, fn func(*core.Record) (bool, error), record *core.Record, preserve ...string) (bool, error) {
+	needsSave, err := fn(record)
+	if err != nil {
+		return false, fmt.Errorf("[applyEnricher]: %w", err)
+	}
+	if !needsSave {
+		return false, nil
+	}
+
+	var patch []string
+	for _, field := range changedFields(record, record.Collection().Fields.FieldNames()) {
+		if !slices.Contains(preserve, field) {
+			patch = append(patch, field)
+		}
+	}
+	if len(patch) == 0 {
+		return false, nil
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		fresh, err := txApp.FindRecordById(record.Collection(), record.Id)
+		if err != nil {
+			return fmt.Errorf("[applyEnricher][FindRecordById]: %w", err)
+		}
+		for _, field := range patch {
+			fresh.Set(field, record.GetRaw(field))
+		}
+		if err := txApp.Save(fresh); err != nil {
+			return fmt.Errorf("[applyEnricher][save]: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// linkFields lists, per collection, the URL fields the link checker probes.
+var linkFields = map[string][]string{
+	"bookmarks": {"url"},
+	"feeds":     {"url", "rss"},
+}
+
+const (
+	// defaultLinkCheckSchedule runs the link checker daily at 03:00.
+	defaultLinkCheckSchedule = "0 3 * * *"
+	// defaultLinkDeadAfter is how many checks in a row must fail before `dead` is set.
+	defaultLinkDeadAfter = 3
+	linkCheckConcurrency = 4
+	linkCheckTimeout     = 30 * time.Second
+	linkUserAgent        = "Mozilla/5.0 (compatible; Rivendell/1.0; +link checker)"
+)
+
+// linkOutcome classifies a link check.
+type linkOutcome int
+
+const (
+	linkOK           linkOutcome = iota
+	linkBroken                   // counts towards `dead`
+	linkInconclusive             // blocked or rate limited: says nothing about the link itself
+)
+
+// linkResult is what checking a record's links found. Status and Err come from the
+// link that decided the outcome.
+type linkResult struct {
+	Outcome linkOutcome
+	Status  int // final HTTP status after redirects; 0 when the request failed
+	Err     error
+}
+
+// linkFailure is a record whose links failed in a checker run.
+type linkFailure struct {
+	Collection string
+	Record     string
+	Failures   int
+	Dead       bool
+	Err        error
+}
+
+// linkReport is what a link checker run found.
+type linkReport struct {
+	Checked int
+	Broken  []linkFailure
+	Revived int // records that were dead and are reachable again
+}
+
+// requestLink sends one request to url, following redirects, and returns the final
+// status.
+func requestLink(client *http.Client, method, url string) (int, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("[requestLink][http.NewRequest]: %w", err)
+	}
+	req.Header.Set("User-Agent", linkUserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("[requestLink][client.Do]: %w", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// probeLink requests url with HEAD and, since plenty of servers mishandle HEAD
+// (405, or a 404 for pages that exist), confirms anything but success with a GET.
+// Returns the final status after redirects; the error is set only when no response
+// came back at all.
+func probeLink(url string) (int, error) {
+	client := &http.Client{Timeout: linkCheckTimeout}
+
+	status, err := requestLink(client, http.MethodHead, url)
+	if err == nil && status < http.StatusBadRequest {
+		return status, nil
+	}
+	return requestLink(client, http.MethodGet, url)
+}
+
+// classifyLink turns a probe into an outcome. Auth walls and rate limits (401, 403,
+// 429) are common for bots on pages that are fine, so they don't count either way.
+func classifyLink(status int, err error) linkResult {
+	switch {
+	case err != nil:
+		return linkResult{Outcome: linkBroken, Err: err}
+	case status == http.StatusUnauthorized, status == http.StatusForbidden, status == http.StatusTooManyRequests:
+		return linkResult{Outcome: linkInconclusive, Status: status, Err: fmt.Errorf("%d %s", status, http.StatusText(status))}
+	case status >= http.StatusBadRequest:
+		return linkResult{Outcome: linkBroken, Status: status, Err: fmt.Errorf("%d %s", status, http.StatusText(status))}
+	}
+	return linkResult{Outcome: linkOK, Status: status}
+}
+
+// checkRecordLinks probes each of the record's link fields. A broken link decides
+// the result over an inconclusive one, which decides it over working ones.
+func checkRecordLinks(r *core.Record, probe func(string) (int, error)) linkResult {
+	result := linkResult{Outcome: linkOK}
+	for _, field := range linkFields[r.Collection().Name] {
+		url := r.GetString(field)
+		if url == "" {
+			continue
+		}
+
+		link := classifyLink(probe(url))
+		if link.Err != nil {
+			link.Err = fmt.Errorf("%s: %w", field, link.Err)
+		}
+		if link.Outcome == linkBroken || (link.Outcome == linkInconclusive && result.Outcome == linkOK) {
+			result = link
+		}
+		if result.Outcome == linkOK {
+			result.Status = link.Status
+		}
+	}
+	return result
+}
+
+// applyLinkResult writes a check's result to the record: a working link resets the
+// failure count and clears `dead`; a broken one sets `dead` once deadAfter checks
+// in a row have failed. Inconclusive checks leave both alone.
+func applyLinkResult(r *core.Record, result linkResult, deadAfter int) {
+	switch result.Outcome {
+	case linkOK:
+		r.Set("link_failures", 0)
+		r.Set("dead", false)
+	case linkBroken:
+		failures := r.GetInt("link_failures") + 1
+		r.Set("link_failures", failures)
+		if failures >= deadAfter {
+			r.Set("dead", true)
+		}
+	}
+
+	errText := ""
+	if result.Err != nil {
+		errText = result.Err.Error()
+	}
+	r.Set("link_status", result.Status)
+	r.Set("link_error", errText)
+	r.Set("link_checked", types.NowDateTime())
+}
+
+// linksChanged reports whether any of the record's link fields differ between two
+// copies of it.
+func linksChanged(a, b *core.Record) bool {
+	for _, field := range linkFields[a.Collection().Name] {
+		if a.GetString(field) != b.GetString(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveLinkResult writes the link columns set by applyLinkResult, and nothing else:
+// the update skips the record hooks and leaves `updated` alone, so a daily check
+// doesn't mark every record as edited.
+func saveLinkResult(app core.App, r *core.Record) error {
+	_, err := app.DB().Update(
+		r.Collection().Name,
+		dbx.Params{
+			"dead":          r.GetBool("dead"),
+			"link_failures": r.GetInt("link_failures"),
+			"link_status":   r.GetInt("link_status"),
+			"link_error":    r.GetString("link_error"),
+			"link_checked":  r.GetDateTime("link_checked"),
+		},
+		dbx.HashExp{"id": r.Id},
+	).Execute()
+	if err != nil {
+		return fmt.Errorf("[saveLinkResult]: %w", err)
+	}
+	return nil
+}
+
+// checkLinks runs the link checker over every bookmark and feed (see linkFields).
+func checkLinks(app core.App, deadAfter int, probe func(string) (int, error)) (linkReport, error) {
+	var (
+		report  linkReport
+		records []*core.Record
+	)
+
+	collections := make([]string, 0, len(linkFields))
+	for collection := range linkFields {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		if _, err := app.FindCachedCollectionByNameOrId(collection); err != nil {
+			continue
+		}
+		found, err := app.FindAllRecords(collection)
+		if err != nil {
+			return report, fmt.Errorf("[checkLinks][FindAllRecords] %s: %w", collection, err)
+		}
+		records = append(records, found...)
+	}
+
+	results := make([]linkResult, len(records))
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, linkCheckConcurrency)
+	)
+	for i, r := range records {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, r *core.Record) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = checkRecordLinks(r, probe)
+		}(i, r)
+	}
+	wg.Wait()
+
+	// Probing takes a while, and the records may have been edited or enriched since
+	// they were loaded: results are applied to a fresh copy, and only the link columns
+	// are written.
+	for i, loaded := range records {
+		r, err := app.FindRecordById(loaded.Collection(), loaded.Id)
+		if err != nil {
+			continue // deleted during the run
+		}
+		if linksChanged(loaded, r) {
+			continue // the result is for links the record no longer has
+		}
+
+		wasDead := r.GetBool("dead")
+		applyLinkResult(r, results[i], deadAfter)
+		if err := saveLinkResult(app, r); err != nil {
+			log.Printf("[checkLinks][save] %s/%s: %v", r.Collection().Name, r.Id, err)
+			continue
+		}
+
+		if results[i].Outcome == linkBroken {
+			report.Broken = append(report.Broken, linkFailure{
+				Collection: r.Collection().Name,
+				Record:     r.Id,
+				Failures:   r.GetInt("link_failures"),
+				Dead:       r.GetBool("dead"),
+				Err:        results[i].Err,
+			})
+		}
+		if wasDead && !r.GetBool("dead") {
+			report.Revived++
+		}
+	}
+
+	report.Checked = len(records)
+	return report, nil
+}
+
+// linkDeadAfter parses LINK_DEAD_AFTER, defaulting to defaultLinkDeadAfter.
+func linkDeadAfter(value string) (int, error) {
+	if value == "" {
+		return defaultLinkDeadAfter, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("[linkDeadAfter]: LINK_DEAD_AFTER must be a positive number, got %q", value)
+	}
+	return n, nil
+}
+
+// logLinkReport logs each broken link and a summary line.
+func logLinkReport(report linkReport) {
+	var dead int
+	for _, f := range report.Broken {
+		state := fmt.Sprintf("failed %d in a row", f.Failures)
+		if f.Dead {
+			state = "dead"
+			dead++
+		}
+		log.Printf("[check-links] %s/%s %s: %v", f.Collection, f.Record, state, f.Err)
+	}
+	log.Printf("[check-links] %d checked, %d broken (%d dead), %d revived", report.Checked, len(report.Broken), dead, report.Revived)
+}
+
+// scheduleLinkChecks runs the link checker on the cron schedule (defaults to
+// defaultLinkCheckSchedule; "off" disables it) while the server is running.
+func scheduleLinkChecks(app core.App, schedule string, deadAfter int) error {
+	if schedule == "off" {
+		return nil
+	}
+	if schedule == "" {
+		schedule = defaultLinkCheckSchedule
+	}
+
+	err := app.Cron().Add("linkCheck", schedule, func() {
+		report, err := checkLinks(app, deadAfter, probeLink)
+		if err != nil {
+			log.Printf("[check-links]: %v", err)
+			return
+		}
+		logLinkReport(report)
+	})
+	if err != nil {
+		return fmt.Errorf("[scheduleLinkChecks] %q: %w", schedule, err)
+	}
+	return nil
+}
+
+// newCheckLinksCmd builds the `check-links` command, which runs the link checker once.
+func newCheckLinksCmd(app core.App, deadAfter int) *cobra.Command {
+	return &cobra.Command{
+		Use:          "check-links",
+		Short:        "Check bookmark and feed links, marking ones that keep failing as dead",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := checkLinks(app, deadAfter, probeLink)
+			if err != nil {
+				return err
+			}
+			logLinkReport(report)
+			return nil
+		},
+	}
+}
@@ -1,343 +1,350 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"strconv"
+	"os"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/fourjuaneight/rivendell/helpers"
-	_ "github.com/fourjuaneight/rivendell/migrations"
+	"github.com/fourjuaneight/rivendell/migrations"
 	"github.com/fourjuaneight/rivendell/utils"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/plugins/migratecmd"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
-func archive(name string, url string, typeName string) (string, error) {
-	media, err := helpers.GetContent(name, url, typeName)
+// warcContentType is what WARC captures are stored as.
+const warcContentType = "application/warc"
+
+// archive stores a bookmark's content and returns the fields pointing at it: the
+// archive URL, or with ASSET_STORAGE=file, the archive_file (plus snapshot_file and
+// warc_file), the Save Page Now snapshot when SPN_ENDPOINT is set, and `archives`
+// listing every artifact and whether it was stored. previous is the bookmark's last
+// list: while the archived content hasn't changed, snapshots that were stored are
+// kept rather than captured again, so re-archiving only retries the failed ones.
+func archive(assets *assetStore, recordID, name, creator, url, typeName string, previous []archiveArtifact) (map[string]any, error) {
+	rules, err := extractionRules(assets.app)
 	if err != nil {
-		return "", fmt.Errorf("[archive][GetContent]: %w", err)
+		return nil, fmt.Errorf("[archive]%w", err)
 	}
 
-	typeOps := utils.GetFileType(typeName, url)
-	list := utils.ToCapitalized(typeName)
-	filename := fmt.Sprintf("%s/%s.%s", list, utils.FileNameFmt(name), typeOps.File)
-	archiveUrl, err := helpers.UploadToB2(media, "bookmarks", filename, typeOps.MIME)
+	// Article images are mirrored into a folder named after the article, next to its
+	// archive. File fields have nowhere to put them, so there they keep linking to the
+	// source.
+	images, err := helpers.LoadImageOptions()
 	if err != nil {
-		return "", fmt.Errorf("[archive][UploadToB2]: %w", err)
-	}
-
-	// For articles, also upload a SingleFile HTML snapshot to B2 for later use.
-	// Errors are non-fatal — the MD archive is the primary output.
-	if typeName == "articles" {
-		sfData, sfErr := helpers.GetSingleFile(url)
-		if sfErr != nil {
-			log.Printf("[archive][GetSingleFile]: %v", sfErr)
-		} else {
-			sfFilename := fmt.Sprintf("Articles/%s.html", utils.FileNameFmt(name))
-			if _, sfUploadErr := helpers.UploadToB2(sfData, "bookmarks", sfFilename, "text/html"); sfUploadErr != nil {
-				log.Printf("[archive][UploadToB2 SingleFile]: %v", sfUploadErr)
+		return nil, fmt.Errorf("[archive]%w", err)
+	}
+	var mirrored []string
+	if !assets.files {
+		images.Mirror = func(imageName string, data []byte, contentType string) (string, error) {
+			filename := fmt.Sprintf("Articles/%s/%s", utils.FileNameFmt(name), imageName)
+			mirror, err := assets.put("bookmarks", filename, bytes.NewReader(data), contentType, "")
+			if err != nil {
+				return "", err
 			}
+			mirrored = append(mirrored, mirror)
+			return mirror, nil
 		}
 	}
 
-	return archiveUrl, nil
-}
-
-func downloadCover(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+	media, _, err := helpers.GetContent(name, creator, url, typeName, rules, images)
 	if err != nil {
-		return nil, fmt.Errorf("[downloadCover][http.Get]: %w", err)
+		return nil, fmt.Errorf("[archive][GetContent]: %w", err)
 	}
-	defer resp.Body.Close()
+	defer media.Close()
 
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("[downloadCover][io.ReadAll]: %w", err)
-	}
-	return data, nil
-}
+	typeOps := utils.GetFileType(typeName, url)
+	list := utils.ToCapitalized(typeName)
+	filename := fmt.Sprintf("%s/%s.%s", list, utils.FileNameFmt(name), typeOps.File)
 
-func uploadCoverToB2(coverURL, collection, filename string) (string, error) {
-	data, err := downloadCover(coverURL)
-	if err != nil {
-		return "", fmt.Errorf("[uploadCoverToB2]: %w", err)
+	kind := archiveMedia
+	if typeName == "articles" {
+		kind = archiveMarkdown
 	}
-	return helpers.UploadToB2(data, collection, filename, "image/jpeg")
-}
 
-// ── Enrichers ────────────────────────────────────────────────────────────────
+	fields := map[string]any{}
+	var primary archiveArtifact
+	if assets.files {
+		digest := &countingHash{Hash: sha1.New()}
+		file, err := assets.spool(recordID, filename, io.TeeReader(media, digest))
+		if err != nil {
+			return nil, fmt.Errorf("[archive][Put]: %w", err)
+		}
+		fields["archive_file"] = file
+		primary = fileArtifact(kind, "archive_file", file.Name, typeOps.MIME, digest.n, hex.EncodeToString(digest.Sum(nil)))
+	} else {
+		asset, err := assets.putAsset("bookmarks", filename, media, typeOps.MIME, "")
+		if err != nil {
+			return nil, fmt.Errorf("[archive][Put]: %w", err)
+		}
+		fields["archive"] = asset.GetString("url")
+		primary = assetArtifact(kind, asset)
 
-func enrichBookmarks(r *core.Record) (bool, error) {
-	archiveURL, err := archive(r.GetString("title"), r.GetString("url"), r.GetString("type"))
-	if err != nil {
-		return false, fmt.Errorf("[enrichBookmarks]: %w", err)
+		var replaced string
+		if last := findArtifact(previous, kind); last != nil {
+			replaced = last.URL
+		}
+		if err := assets.adopt(mirrored, asset.GetString("url"), replaced); err != nil {
+			log.Printf("[archive][adopt]: %v", err)
+		}
 	}
-	r.Set("archive", archiveURL)
-	return true, nil
-}
-
-func enrichGithub(r *core.Record) (bool, error) {
-	repo, err := helpers.GetRepoInfo(r.GetString("url"))
-	if err != nil {
-		return false, fmt.Errorf("[enrichGithub]: %w", err)
+	artifacts := []archiveArtifact{primary}
+
+	// keep stores a snapshot accompanying the archive: in its file field, or as an
+	// asset deleted along with the archive. Errors are non-fatal — the archive is the
+	// primary output — and listed as failed artifacts.
+	keep := func(kind, filename, contentType string, data []byte) archiveArtifact {
+		if assets.files {
+			field := archiveFileFields[kind]
+			file, err := assets.spool(recordID, filename, bytes.NewReader(data))
+			if err != nil {
+				log.Printf("[archive][spool %s]: %v", field, err)
+				return failedArtifact(kind, err)
+			}
+			fields[field] = file
+			return fileArtifact(kind, field, file.Name, contentType, int64(len(data)), sha1Hex(data))
+		}
+		asset, err := assets.putAsset("bookmarks", filename, bytes.NewReader(data), contentType, fields["archive"].(string))
+		if err != nil {
+			log.Printf("[archive][Put %s]: %v", kind, err)
+			return failedArtifact(kind, err)
+		}
+		return assetArtifact(kind, asset)
 	}
-	r.Set("name", repo.Name)
-	r.Set("owner", repo.Owner)
-	r.Set("description", repo.Description)
-	r.Set("language", repo.Language)
-	return true, nil
-}
 
-func enrichMtg(r *core.Record) (bool, error) {
-	cardSelection, err := helpers.SearchCard(r.GetString("name"), r.GetString("set"), r.GetInt("collector_number"))
-	if err != nil {
-		return false, fmt.Errorf("[enrichMtg]: %w", err)
-	}
-
-	var card helpers.MTGItem
-	for _, c := range cardSelection {
-		card = c
-		break
-	}
-
-	// Only overwrite card fields when caller didn't provide full data.
-	// rarity is a reliable sentinel — always set by Scryfall, never by the caller alone.
-	if r.GetString("rarity") == "" {
-		r.Set("colors", card.Colors)
-		r.Set("type", card.Type)
-		r.Set("set_name", card.SetName)
-		r.Set("oracle_text", card.OracleText)
-		r.Set("flavor_text", card.FlavorText)
-		r.Set("rarity", card.Rarity)
-		r.Set("artist", card.Artist)
-		r.Set("released_at", card.ReleasedAt)
-		if card.Back != nil {
-			r.Set("back", card.Back)
+	// For articles, also store a SingleFile HTML snapshot and a WARC of the page and
+	// its subresources.
+	if typeName == "articles" {
+		slug := utils.FileNameFmt(name)
+
+		if prev, ok := keptArtifact(previous, primary, archiveSingleFile, assets.files); ok {
+			artifacts = append(artifacts, prev)
+		} else if sfData, err := helpers.GetSingleFile(url); err != nil {
+			log.Printf("[archive][GetSingleFile]: %v", err)
+			artifacts = append(artifacts, failedArtifact(archiveSingleFile, err))
+		} else {
+			artifacts = append(artifacts, keep(archiveSingleFile, fmt.Sprintf("Articles/%s.html", slug), "text/html", sfData))
 		}
-	}
 
-	// Download front image from Scryfall, upload to B2, store B2 URL.
-	if card.Image != "" {
-		imageFile := fmt.Sprintf("%s/%s.jpeg", r.GetString("set"), utils.FileNameFmt(r.GetString("name")))
-		b2ImageURL, err := uploadCoverToB2(card.Image, "mtg", imageFile)
-		if err != nil {
-			return false, fmt.Errorf("[enrichMtg]: %w", err)
+		var warc bytes.Buffer
+		if prev, ok := keptArtifact(previous, primary, archiveWARC, assets.files); ok {
+			artifacts = append(artifacts, prev)
+		} else if err := helpers.CaptureWARC(&warc, url); err != nil {
+			log.Printf("[archive][CaptureWARC]: %v", err)
+			artifacts = append(artifacts, failedArtifact(archiveWARC, err))
+		} else {
+			artifacts = append(artifacts, keep(archiveWARC, fmt.Sprintf("Articles/%s.warc", slug), warcContentType, warc.Bytes()))
 		}
-		r.Set("image", b2ImageURL)
 	}
 
-	// Same for back face when present.
-	if card.Back != nil && *card.Back != "" {
-		backFile := fmt.Sprintf("%s/%s-back.jpeg", r.GetString("set"), utils.FileNameFmt(r.GetString("name")))
-		b2BackURL, err := uploadCoverToB2(*card.Back, "mtg", backFile)
-		if err != nil {
-			return false, fmt.Errorf("[enrichMtg]: %w", err)
-		}
-		r.Set("back", b2BackURL)
+	if prev, ok := keptArtifact(previous, primary, archiveWayback, assets.files); ok {
+		artifacts = append(artifacts, prev)
+	} else if snapshot, err := helpers.SavePageNow(url); err != nil {
+		log.Printf("[archive][SavePageNow]: %v", err)
+		artifacts = append(artifacts, failedArtifact(archiveWayback, err))
+	} else if snapshot != "" {
+		fields["wayback"] = snapshot
+		artifacts = append(artifacts, archiveArtifact{Kind: archiveWayback, Status: artifactOK, URL: snapshot, Created: types.NowDateTime()})
 	}
 
-	return true, nil
+	fields["archives"] = artifacts
+	return fields, nil
 }
 
-func enrichBooks(r *core.Record) (bool, error) {
-	isbn := r.GetString("isbn")
-	if isbn == "" {
-		return false, nil
-	}
-
-	book, err := helpers.GetBookInfo(isbn)
+// fetchCover opens the image at coverURL.
+func fetchCover(coverURL string) (io.ReadCloser, error) {
+	resp, err := http.Get(coverURL)
 	if err != nil {
-		return false, fmt.Errorf("[enrichBooks]: %w", err)
-	}
-
-	var needsSave bool
-	if book.Year != 0 {
-		r.Set("year", book.Year)
-		needsSave = true
+		return nil, fmt.Errorf("[fetchCover][http.Get]: %w", err)
 	}
-	if book.CoverURL != "" {
-		b2URL, err := uploadCoverToB2(book.CoverURL, "books", fmt.Sprintf("%s.jpeg", utils.FileNameFmt(r.GetString("title"))))
-		if err != nil {
-			return false, fmt.Errorf("[enrichBooks]: %w", err)
-		}
-		r.Set("cover", b2URL)
-		needsSave = true
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("[fetchCover]: %s", resp.Status)
 	}
-	return needsSave, nil
+	return resp.Body, nil
 }
 
-func enrichCds(r *core.Record) (bool, error) {
-	album := r.GetString("album")
-	music, err := helpers.GetMusicInfo(album, r.GetString("artist"), r.GetInt("year"), r.GetString("barcode"), "cds")
+// normalizeCover downloads the image at coverURL and normalizes it (see
+// helpers.NormalizeCover).
+func normalizeCover(coverURL string) (helpers.NormalizedCover, error) {
+	body, err := fetchCover(coverURL)
 	if err != nil {
-		return false, fmt.Errorf("[enrichCds]: %w", err)
+		return helpers.NormalizedCover{}, err
 	}
+	defer body.Close()
 
-	var needsSave bool
-	if music.Year != "" {
-		if y, err := strconv.Atoi(music.Year); err == nil && y != 0 {
-			r.Set("year", y)
-			needsSave = true
-		}
-	}
-	if music.CoverURL != "" {
-		b2URL, err := uploadCoverToB2(music.CoverURL, "cds", fmt.Sprintf("%s.jpeg", utils.FileNameFmt(album)))
-		if err != nil {
-			return false, fmt.Errorf("[enrichCds]: %w", err)
-		}
-		r.Set("cover", b2URL)
-		needsSave = true
-	}
-	return needsSave, nil
+	return helpers.NormalizeCover(body)
 }
 
-func enrichGames(r *core.Record) (bool, error) {
-	title := r.GetString("title")
-	game, err := helpers.GetGameInfo(title, r.GetInt("year"))
+// uploadCover stores the normalized image at coverURL, with its thumbnails.
+func uploadCover(assets *assetStore, coverURL, collection, filename string) (string, error) {
+	cover, err := normalizeCover(coverURL)
 	if err != nil {
-		return false, fmt.Errorf("[enrichGames]: %w", err)
-	}
-
-	var needsSave bool
-	if game.Year != 0 {
-		r.Set("year", game.Year)
-		needsSave = true
+		return "", fmt.Errorf("[uploadCover]%w", err)
 	}
-	if game.CoverURL != "" {
-		b2URL, err := uploadCoverToB2(game.CoverURL, "games", fmt.Sprintf("%s.jpeg", utils.FileNameFmt(title)))
-		if err != nil {
-			return false, fmt.Errorf("[enrichGames]: %w", err)
-		}
-		r.Set("cover", b2URL)
-		needsSave = true
-	}
-	return needsSave, nil
+	return assets.putCover(collection, filename, cover)
 }
 
-func enrichMovies(r *core.Record) (bool, error) {
-	title := r.GetString("title")
-	media, err := helpers.SearchMedia(title, r.GetInt("year"), 0, "movies")
+// attachCover normalizes the image at coverURL for a record's file field; PocketBase
+// renders the field's thumbnails itself.
+func attachCover(assets *assetStore, recordID, coverURL, filename string) (*filesystem.File, error) {
+	cover, err := normalizeCover(coverURL)
 	if err != nil {
-		return false, fmt.Errorf("[enrichMovies]: %w", err)
+		return nil, fmt.Errorf("[attachCover]%w", err)
 	}
+	return assets.spool(recordID, helpers.CoverFilename(filename, cover.MIME), bytes.NewReader(cover.Data))
+}
 
-	var needsSave bool
-	if media.Year != "" {
-		if y, err := strconv.Atoi(media.Year); err == nil && y != 0 {
-			r.Set("year", y)
-			needsSave = true
-		}
-	}
-	if media.CoverURL != "" {
-		b2URL, err := uploadCoverToB2(media.CoverURL, "movies", fmt.Sprintf("%s.jpeg", utils.FileNameFmt(title)))
-		if err != nil {
-			return false, fmt.Errorf("[enrichMovies]: %w", err)
-		}
-		r.Set("cover", b2URL)
-		needsSave = true
-	}
-	return needsSave, nil
+// ── Update triggers ──────────────────────────────────────────────────────────
+
+// enrichKeys lists, per collection, the source fields its enricher looks records up by.
+// Changing any of them on update re-runs the enricher.
+var enrichKeys = map[string][]string{
+	"bookmarks":   {"url", "type"},
+	"github":      {"url"},
+	"mtg":         {"set", "collector_number"},
+	"books":       {"isbn"},
+	"cds":         {"barcode", "album", "artist"},
+	"games":       {"title", "year"},
+	"movies":      {"title", "year"},
+	"shows":       {"title", "year", "season"},
+	"vinyls":      {"barcode", "album", "artist"},
+	"watch_later": {"link"},
 }
 
-func enrichShows(r *core.Record) (bool, error) {
-	title := r.GetString("title")
-	media, err := helpers.SearchMedia(title, r.GetInt("year"), r.GetInt("season"), "shows")
-	if err != nil {
-		return false, fmt.Errorf("[enrichShows]: %w", err)
-	}
+// changedFields returns the fields whose value differs from the record's persisted state.
+func changedFields(r *core.Record, fields []string) []string {
+	original := r.Original()
 
-	var needsSave bool
-	if media.Year != "" {
-		if y, err := strconv.Atoi(media.Year); err == nil && y != 0 {
-			r.Set("year", y)
-			needsSave = true
+	var changed []string
+	for _, field := range fields {
+		if !reflect.DeepEqual(original.Get(field), r.Get(field)) {
+			changed = append(changed, field)
 		}
 	}
-	if media.CoverURL != "" {
-		b2URL, err := uploadCoverToB2(media.CoverURL, "shows", fmt.Sprintf("%s.jpeg", utils.FileNameFmt(title)))
-		if err != nil {
-			return false, fmt.Errorf("[enrichShows]: %w", err)
-		}
-		r.Set("cover", b2URL)
-		needsSave = true
-	}
-	return needsSave, nil
+	return changed
 }
 
-func enrichVinyls(r *core.Record) (bool, error) {
-	album := r.GetString("album")
-	music, err := helpers.GetMusicInfo(album, r.GetString("artist"), r.GetInt("year"), r.GetString("barcode"), "vinyls")
-	if err != nil {
-		return false, fmt.Errorf("[enrichVinyls]: %w", err)
-	}
+// ── Meta name resolvers ───────────────────────────────────────────────────────
 
-	var needsSave bool
-	if music.Year != "" {
-		if y, err := strconv.Atoi(music.Year); err == nil && y != 0 {
-			r.Set("year", y)
-			needsSave = true
-		}
-	}
-	if music.CoverURL != "" {
-		b2URL, err := uploadCoverToB2(music.CoverURL, "vinyls", fmt.Sprintf("%s.jpeg", utils.FileNameFmt(album)))
-		if err != nil {
-			return false, fmt.Errorf("[enrichVinyls]: %w", err)
-		}
-		r.Set("cover", b2URL)
-		needsSave = true
-	}
-	return needsSave, nil
+// Meta policies decide what happens when a name has no exact (normalized) match:
+// strict fails, create adds a new meta record, fuzzy picks the closest existing one.
+const (
+	metaStrict = "strict"
+	metaCreate = "create"
+	metaFuzzy  = "fuzzy"
+)
+
+// defaultMetaPolicies apply when META_POLICY_<TYPE> isn't set.
+var defaultMetaPolicies = map[string]string{
+	"tags":       metaCreate,
+	"genre":      metaFuzzy,
+	"platform":   metaStrict,
+	"definition": metaStrict,
 }
 
-func enrichWatchLater(r *core.Record) (bool, error) {
-	yt, err := helpers.GetYTInfo(r.GetString("link"))
+// metaMu serializes resolve-or-create so concurrent requests don't both create
+// the same meta record.
+var metaMu sync.Mutex
+
+// metaPolicy returns the configured policy for a meta type.
+func metaPolicy(metaType string) string {
+	policy, err := helpers.GetKeys("META_POLICY_" + strings.ToUpper(metaType))
 	if err != nil {
-		return false, fmt.Errorf("[enrichWatchLater]: %w", err)
+		log.Printf("[metaPolicy]: %v", err)
+	}
+	switch policy {
+	case metaStrict, metaCreate, metaFuzzy:
+		return policy
+	case "":
+		if policy, ok := defaultMetaPolicies[metaType]; ok {
+			return policy
+		}
+		return metaStrict
+	default:
+		log.Printf("[metaPolicy]: unknown policy %q for %s, using %s", policy, metaType, metaStrict)
+		return metaStrict
 	}
-	r.Set("title", yt.Title)
-	r.Set("channel", yt.Creator)
-	return true, nil
 }
 
-// ── Meta name resolvers ───────────────────────────────────────────────────────
-
-// resolveTagNames looks up meta records by name and returns their IDs.
-// Allows callers to send tag names instead of opaque relation IDs.
+// resolveTagNames resolves tag names to meta record IDs, in order and without
+// duplicates. Allows callers to send tag names instead of opaque relation IDs.
 func resolveTagNames(app core.App, names []string) ([]string, error) {
-	if len(names) == 0 {
-		return nil, nil
+	var ids []string
+	for _, name := range names {
+		id, err := resolveMetaName(app, name, "tags")
+		if err != nil {
+			return nil, fmt.Errorf("[resolveTagNames]: %w", err)
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
 	}
+	return ids, nil
+}
 
-	parts := make([]string, len(names))
-	for i, name := range names {
-		parts[i] = fmt.Sprintf(`name = "%s"`, name)
+// resolveMetaName resolves a name (or ID) to the ID of a meta record of the given type.
+// Names match case- and separator-insensitively ("Sci-Fi" == "sci fi"); what
+// happens without a match depends on the type's policy.
+func resolveMetaName(app core.App, name, metaType string) (string, error) {
+	if utils.NormalizeName(name) == "" {
+		return "", fmt.Errorf("[resolveMetaName]: empty %s name %q", metaType, name)
 	}
-	filter := fmt.Sprintf(`(%s) && type = "tags"`, strings.Join(parts, " || "))
 
-	records, err := app.FindRecordsByFilter("meta", filter, "", 0, 0)
+	policy := metaPolicy(metaType)
+
+	metaMu.Lock()
+	defer metaMu.Unlock()
+
+	records, err := app.FindRecordsByFilter("meta", "type = {:type}", "name", 0, 0, dbx.Params{"type": metaType})
 	if err != nil {
-		return nil, fmt.Errorf("[resolveTagNames]: %w", err)
+		return "", fmt.Errorf("[resolveMetaName][FindRecordsByFilter]: %w", err)
 	}
 
-	ids := make([]string, len(records))
+	names := make([]string, len(records))
 	for i, r := range records {
-		ids[i] = r.Id
+		// Callers may also send the meta record ID itself.
+		if r.Id == name {
+			return r.Id, nil
+		}
+		names[i] = r.GetString("name")
+	}
+	if i := utils.MatchName(names, name, policy == metaFuzzy); i >= 0 {
+		return records[i].Id, nil
 	}
-	return ids, nil
-}
 
-// resolveMetaName looks up a single meta record by name and type, returning its ID.
-func resolveMetaName(app core.App, name, metaType string) (string, error) {
-	filter := fmt.Sprintf(`name = "%s" && type = "%s"`, name, metaType)
-	record, err := app.FindFirstRecordByFilter("meta", filter)
+	if policy != metaCreate {
+		return "", fmt.Errorf("[resolveMetaName]: no %s named %q", metaType, name)
+	}
+
+	meta, err := app.FindCollectionByNameOrId("meta")
 	if err != nil {
-		return "", fmt.Errorf("[resolveMetaName] %q (%s): %w", name, metaType, err)
+		return "", fmt.Errorf("[resolveMetaName][FindCollectionByNameOrId]: %w", err)
+	}
+	record := core.NewRecord(meta)
+	record.Set("name", strings.Join(strings.Fields(name), " "))
+	record.Set("type", metaType)
+	if err := app.Save(record); err != nil {
+		return "", fmt.Errorf("[resolveMetaName][save]: %w", err)
 	}
+	log.Printf("[resolveMetaName] created %s %q", metaType, record.GetString("name"))
+
 	return record.Id, nil
 }
 
@@ -378,6 +385,21 @@ func prepareWithGenre(app core.App, r *core.Record) error {
 	return nil
 }
 
+// prepareBook validates the ISBN and stores it as a canonical ISBN-13, so an
+// invalid one is rejected with a field error instead of failing enrichment later.
+func prepareBook(app core.App, r *core.Record) error {
+	if isbn := r.GetString("isbn"); isbn != "" {
+		isbn13, err := utils.NormalizeISBN(isbn)
+		if err != nil {
+			return fmt.Errorf("[prepareBook]: %w", validation.Errors{
+				"isbn": validation.NewError("validation_invalid_isbn", fmt.Sprintf("Invalid ISBN %q: %v.", isbn, err)),
+			})
+		}
+		r.Set("isbn", isbn13)
+	}
+	return prepareWithGenre(app, r)
+}
+
 func prepareMovieOrShow(app core.App, r *core.Record) error {
 	if err := prepareWithGenre(app, r); err != nil {
 		return err
@@ -406,46 +428,43 @@ func prepareGame(app core.App, r *core.Record) error {
 	return nil
 }
 
-// ── Main ──────────────────────────────────────────────────────────────────────
-
-func main() {
-	app := pocketbase.New()
-
-	// Automigrate: on startup, applies any pending migrations in the migrations/ package.
-	// In dev mode (binary built from source), also auto-generates migration files when
-	// collections are modified via the admin UI.
-	migratecmd.MustRegister(app, app.RootCmd, migratecmd.Config{
-		Automigrate: true,
-	})
+// preparers run before e.Next() — set defaults and resolve relation names to IDs.
+var preparers = map[string]func(core.App, *core.Record) error{
+	"bookmarks":   prepareBookmark,
+	"feeds":       prepareFeed,
+	"books":       prepareBook,
+	"cds":         prepareWithGenre,
+	"games":       prepareGame,
+	"movies":      prepareMovieOrShow,
+	"shows":       prepareMovieOrShow,
+	"vinyls":      prepareWithGenre,
+	"read_later":  prepareTags,
+	"watch_later": prepareTags,
+}
 
-	// preparers run before e.Next() — set defaults and resolve relation names to IDs.
-	preparers := map[string]func(core.App, *core.Record) error{
-		"bookmarks":   prepareBookmark,
-		"feeds":       prepareFeed,
-		"books":       prepareWithGenre,
-		"cds":         prepareWithGenre,
-		"games":       prepareGame,
-		"movies":      prepareMovieOrShow,
-		"shows":       prepareMovieOrShow,
-		"vinyls":      prepareWithGenre,
-		"read_later":  prepareTags,
-		"watch_later": prepareTags,
-	}
-
-	// enrichers run after e.Next() — call external APIs and write enriched fields back.
-	enrichers := map[string]func(*core.Record) (bool, error){
-		"bookmarks":   enrichBookmarks,
-		"github":      enrichGithub,
-		"mtg":         enrichMtg,
-		"books":       enrichBooks,
-		"cds":         enrichCds,
-		"games":       enrichGames,
-		"movies":      enrichMovies,
-		"shows":       enrichShows,
-		"vinyls":      enrichVinyls,
-		"watch_later": enrichWatchLater,
-	}
+// ── Hooks ─────────────────────────────────────────────────────────────────────
+
+// newEnrichers registers each collection's enrichers. Several enrichers on one
+// collection act as a fallback chain, tried in registration order.
+func newEnrichers(app core.App, assets *assetStore) *Registry {
+	enrichers := newRegistry(assets)
+	enrichers.Register("bookmarks", bookmarkArchiver{assets: assets})
+	enrichers.Register("github", githubEnricher{})
+	enrichers.Register("mtg", scryfallEnricher{})
+	enrichers.Register("books", openLibraryEnricher{}, googleBooksEnricher{})
+	enrichers.Register("cds", discogsEnricher{mediaType: "cds"})
+	enrichers.Register("games", igdbEnricher{})
+	enrichers.Register("movies", tmdbEnricher{app: app, mediaType: "movies"})
+	enrichers.Register("shows", tmdbEnricher{app: app, mediaType: "shows"})
+	enrichers.Register("vinyls", discogsEnricher{mediaType: "vinyls"})
+	enrichers.Register("watch_later", youtubeEnricher{})
+
+	return enrichers
+}
 
+// bindRecordHooks runs the preparers on create and queues enrichment after creates
+// and relevant updates.
+func bindRecordHooks(app core.App, enrichers *Registry, queue *jobQueue) {
 	app.OnRecordCreateRequest(
 		"bookmarks", "feeds", "github", "mtg",
 		"books", "cds", "games", "movies", "shows", "vinyls",
@@ -461,24 +480,143 @@ func main() {
 			return err
 		}
 
-		fn := enrichers[e.Collection.Name]
-		if fn == nil {
+		if !enrichers.Has(e.Collection.Name) {
 			return nil
 		}
 
-		needsSave, err := fn(e.Record)
-		if err != nil {
+		if err := queue.enqueue(e.Collection.Name, e.Record.Id, nil); err != nil {
 			return fmt.Errorf("[OnRecordCreateRequest]: %w", err)
 		}
 
-		if needsSave {
-			if err := e.App.Save(e.Record); err != nil {
-				return fmt.Errorf("[OnRecordCreateRequest][save]: %w", err)
-			}
+		return nil
+	})
+
+	// On update, only re-enrich when a field the enricher looks up by has changed.
+	app.OnRecordUpdateRequest(
+		"bookmarks", "github", "mtg",
+		"books", "cds", "games", "movies", "shows", "vinyls",
+		"watch_later",
+	).BindFunc(func(e *core.RecordRequestEvent) error {
+		if len(changedFields(e.Record, enrichKeys[e.Collection.Name])) == 0 {
+			return e.Next()
+		}
+
+		// Anything the caller edited in this request wins over the enricher.
+		preserve := changedFields(e.Record, e.Record.Collection().Fields.FieldNames())
+
+		// rarity is enrichMtg's "already enriched" sentinel; clear it so the new
+		// card's fields replace the old card's, unless the caller set it themselves.
+		if e.Collection.Name == "mtg" && !slices.Contains(preserve, "rarity") {
+			e.Record.Set("rarity", "")
+		}
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		if err := queue.enqueue(e.Collection.Name, e.Record.Id, preserve); err != nil {
+			return fmt.Errorf("[OnRecordUpdateRequest]: %w", err)
 		}
 
 		return nil
 	})
+}
+
+// ── Main ──────────────────────────────────────────────────────────────────────
+
+func main() {
+	app := pocketbase.New()
+
+	// Automigrate: on startup, applies any pending migrations in the migrations/ package.
+	// In dev mode (binary built from source), also auto-generates migration files when
+	// collections are modified via the admin UI.
+	migratecmd.MustRegister(app, app.RootCmd, migratecmd.Config{
+		Automigrate: true,
+	})
+
+	// Archives and covers are mirrored to the backend selected by STORAGE_BACKEND.
+	store, err := helpers.NewStorage()
+	if err != nil {
+		log.Fatalf("[NewStorage]: %v", err)
+	}
+
+	// Uploads are deduplicated by content hash and tracked in _assets, so they can be
+	// deleted once no record references them. ASSET_STORAGE=file attaches them to the
+	// records' file fields instead.
+	assetMode, err := helpers.GetKeys("ASSET_STORAGE")
+	if err != nil {
+		log.Fatalf("[GetKeys]: %v", err)
+	}
+	assets := newAssetStore(app, store)
+	assets.files = assetMode == "file"
+
+	// Records stored before the switch to ASSET_STORAGE=file are converted once, by
+	// the convert_assets_to_files migration.
+	migrations.ConvertAssets = convertOnMigrate(assets)
+
+	// enrichers run from the job queue after the record is saved — call external APIs
+	// and write enriched fields back.
+	enrichers := newEnrichers(app, assets)
+
+	// Enrichment runs in the background so slow downloads and uploads don't hold the
+	// create request open. Jobs are persisted in _jobs and resumed after a restart.
+	queue := newJobQueue(app, enrichers)
+
+	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		if err := queue.start(); err != nil {
+			return fmt.Errorf("[OnServe]: %w", err)
+		}
+
+		// Local storage has no web server of its own; serve it alongside the API.
+		if local, ok := store.(*helpers.LocalStorage); ok {
+			e.Router.GET("/storage/{path...}", apis.Static(os.DirFS(local.Dir()), false))
+		}
+
+		return e.Next()
+	})
+
+	// Stored archives and covers are checked periodically; broken ones are recorded in
+	// _asset_checks for `reenrich --broken`.
+	checkSchedule, err := helpers.GetKeys("ASSET_CHECK_SCHEDULE")
+	if err != nil {
+		log.Fatalf("[GetKeys]: %v", err)
+	}
+	if err := scheduleAssetChecks(app, assets, checkSchedule); err != nil {
+		log.Fatalf("[scheduleAssetChecks]: %v", err)
+	}
+
+	// Bookmark and feed links are checked periodically; `dead` is set once a link has
+	// failed LINK_DEAD_AFTER checks in a row.
+	linkSchedule, err := helpers.GetKeys("LINK_CHECK_SCHEDULE")
+	if err != nil {
+		log.Fatalf("[GetKeys]: %v", err)
+	}
+	deadAfterKey, err := helpers.GetKeys("LINK_DEAD_AFTER")
+	if err != nil {
+		log.Fatalf("[GetKeys]: %v", err)
+	}
+	deadAfter, err := linkDeadAfter(deadAfterKey)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := scheduleLinkChecks(app, linkSchedule, deadAfter); err != nil {
+		log.Fatalf("[scheduleLinkChecks]: %v", err)
+	}
+
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		queue.stop()
+		return e.Next()
+	})
+
+	bindRecordHooks(app, enrichers, queue)
+	bindAssetHooks(app, assets)
+	bindExtractionRuleHooks(app)
+
+	app.RootCmd.AddCommand(newReenrichCmd(app, enrichers))
+	app.RootCmd.AddCommand(newGCCmd(app, assets))
+	app.RootCmd.AddCommand(newConvertAssetsCmd(app, assets))
+	app.RootCmd.AddCommand(newCheckAssetsCmd(app, assets))
+	app.RootCmd.AddCommand(newCheckLinksCmd(app, deadAfter))
 
 	if err := app.Start(); err != nil {
 		log.Fatal("[Start]: %w", err)
@@ -0,0 +1,2276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fourjuaneight/rivendell/helpers"
+	"github.com/fourjuaneight/rivendell/schema"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// hostileNames try to break out of a quoted filter string or smuggle in filter syntax.
+var hostileNames = []string{
+	`x" || name != "`,
+	`" || type = "genre`,
+	`secret" && type = "tags`,
+	`{:type}`,
+	`back\slash"`,
+	`') OR 1=1 --`,
+}
+
+// TestMain runs the tests from a temp dir holding the .env that schema.GetMetaID
+// and helpers.GetKeys read, so a developer's real .env is never touched.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "rivendell")
+	if err != nil {
+		panic(err)
+	}
+	env := "META_ID=metacollection01\nMETA_POLICY_TAGS=create\nMETA_POLICY_PLATFORM=strict\n"
+	if err := os.WriteFile(dir+"/.env", []byte(env), 0o600); err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestApp returns a test app with the meta, bookmarks and games collections, a
+// few seeded meta records and the record hooks bound.
+func newTestApp(t testing.TB) *tests.TestApp {
+	app, _ := newTestAppWithAssets(t)
+	return app
+}
+
+// newTestAppWithAssets is newTestApp, also returning the asset store its hooks use,
+// backed by local storage in a temp dir.
+func newTestAppWithAssets(t testing.TB) (*tests.TestApp, *assetStore) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []*core.Collection{schema.MetaCollection(), schema.BookmarksCollection(), schema.GamesCollection()} {
+		if err := app.Save(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	meta, err := app.FindCollectionByNameOrId("meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seed := range [][2]string{{"secret", "tags"}, {"PS5", "platform"}, {"genre", "genre"}} {
+		record := core.NewRecord(meta)
+		record.Set("name", seed[0])
+		record.Set("type", seed[1])
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := helpers.NewLocalStorageAt(t.TempDir(), "http://127.0.0.1:8090/storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets := newAssetStore(app, store)
+	enrichers := newEnrichers(app, assets)
+	bindRecordHooks(app, enrichers, newJobQueue(app, enrichers))
+	bindAssetHooks(app, assets)
+	bindExtractionRuleHooks(app)
+
+	return app, assets
+}
+
+func TestCreateBookmarkWithHostileTags(t *testing.T) {
+	tags := hostileNames[:5] // bookmarks allow at most 5 tags
+	body, err := json.Marshal(map[string]any{
+		"title":   "Hostile",
+		"creator": "me",
+		"url":     "https://example.com",
+		"type":    "articles",
+		"tags":    tags,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenario := tests.ApiScenario{
+		Name:            "hostile tag names are stored literally",
+		Method:          http.MethodPost,
+		URL:             "/api/collections/bookmarks/records",
+		Body:            bytes.NewReader(body),
+		ExpectedStatus:  200,
+		ExpectedContent: []string{`"title":"Hostile"`},
+		TestAppFactory:  newTestApp,
+		AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+			bookmark, err := app.FindFirstRecordByData("bookmarks", "title", "Hostile")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tagIDs := bookmark.GetStringSlice("tags")
+			if len(tagIDs) != len(tags) {
+				t.Fatalf("got %d tags, want %d", len(tagIDs), len(tags))
+			}
+
+			for i, id := range tagIDs {
+				tag, err := app.FindRecordById("meta", id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := tag.GetString("name"); got != tags[i] {
+					t.Errorf("tag %d name = %q, want %q", i, got, tags[i])
+				}
+				if tag.GetString("type") != "tags" {
+					t.Errorf("tag %d type = %q, want tags", i, tag.GetString("type"))
+				}
+				if tag.GetString("name") == "secret" {
+					t.Errorf("tag %d resolved to the seeded %q tag", i, "secret")
+				}
+			}
+		},
+	}
+
+	scenario.Test(t)
+}
+
+func TestResolveHostileMetaNames(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	for _, name := range hostileNames {
+		t.Run(name, func(t *testing.T) {
+			// platform is strict: hostile names must miss, not match the seeded PS5.
+			if id, err := resolveMetaName(app, name, "platform"); err == nil {
+				t.Errorf("resolveMetaName(%q, platform) = %q, want error", name, id)
+			}
+
+			// tags auto-create: the hostile name is stored verbatim as a new tag.
+			id, err := resolveMetaName(app, name, "tags")
+			if err != nil {
+				t.Fatalf("resolveMetaName(%q, tags): %v", name, err)
+			}
+			tag, err := app.FindRecordById("meta", id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tag.GetString("type") != "tags" || tag.GetString("name") == "secret" {
+				t.Errorf("resolveMetaName(%q, tags) resolved to %s %q", name, tag.GetString("type"), tag.GetString("name"))
+			}
+		})
+	}
+}
+
+func TestCreateGameWithHostilePlatform(t *testing.T) {
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "known platform resolves",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/games/records",
+			Body:            strings.NewReader(`{"title":"Astro Bot","platform":"ps5"}`),
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"title":"Astro Bot"`},
+			TestAppFactory:  newTestApp,
+		},
+		{
+			Name:            "quote breakout is rejected",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/games/records",
+			Body:            strings.NewReader(`{"title":"Hostile","platform":"x\" || name != \""}`),
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  newTestApp,
+		},
+		{
+			Name:            "type smuggling is rejected",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/games/records",
+			Body:            strings.NewReader(`{"title":"Hostile","platform":"PS5\" || type = \"genre"}`),
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  newTestApp,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestCreateBookISBN(t *testing.T) {
+	// newTestApp has no books collection.
+	newBooksApp := func(t testing.TB) *tests.TestApp {
+		app := newTestApp(t)
+		if err := app.Save(schema.BooksCollection()); err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "invalid ISBN is a field error",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/books/records",
+			Body:            strings.NewReader(`{"title":"Dune","author":"Frank Herbert","isbn":"0441172718"}`),
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"isbn":{"code":"validation_invalid_isbn"`},
+			TestAppFactory:  newBooksApp,
+		},
+		{
+			Name:            "ISBN-10 is stored as ISBN-13",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/books/records",
+			Body:            strings.NewReader(`{"title":"Dune","author":"Frank Herbert","isbn":"0-441-17271-7"}`),
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"isbn":"9780441172719"`},
+			TestAppFactory:  newBooksApp,
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				book, err := app.FindFirstRecordByData("books", "title", "Dune")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := book.GetString("isbn"); got != "9780441172719" {
+					t.Errorf("stored isbn = %q, want 9780441172719", got)
+				}
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestAssetStoreDedup(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	put := func(collection, filename, content string) string {
+		t.Helper()
+		url, err := assets.put(collection, filename, strings.NewReader(content), "text/plain", "")
+		if err != nil {
+			t.Fatalf("put(%q, %q): %v", collection, filename, err)
+		}
+		return url
+	}
+
+	first := put("bookmarks", "Articles/Same Title.md", "first article")
+	second := put("bookmarks", "Articles/Same Title.md", "second article")
+	if first == second {
+		t.Errorf("same title, different content share URL %q", first)
+	}
+	if !strings.Contains(first, "Same%20Title-") {
+		t.Errorf("URL %q lost the readable slug", first)
+	}
+
+	cover := put("books", "Dune.jpeg", "cover bytes")
+	if again := put("movies", "Dune.jpeg", "cover bytes"); again != cover {
+		t.Errorf("identical content stored twice: %q and %q", cover, again)
+	}
+
+	total, err := app.CountRecords(assetsCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Errorf("_assets has %d records, want 3", total)
+	}
+}
+
+func TestUploadRecordedTwice(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	upload := func(key string) (*core.Record, error) {
+		return assets.upload(key, strings.NewReader("content"), 7, "text/plain", sha1Hex([]byte("content")), "")
+	}
+
+	first, err := upload("PocketBase/Bookmarks/Same.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A concurrent upload of the same content to the same key reuses the first row.
+	again, err := upload("PocketBase/Bookmarks/Same.txt")
+	if err != nil {
+		t.Fatalf("same key: %v", err)
+	}
+	if again.Id != first.Id {
+		t.Errorf("same key returned row %q, want %q", again.Id, first.Id)
+	}
+
+	// The same content under another key can't be recorded: the object is removed
+	// instead of being left for gc to delete.
+	if _, err := upload("PocketBase/Bookmarks/Other.txt"); err == nil {
+		t.Error("another key: no error")
+	}
+	if keys := storedKeys(t, assets); len(keys) != 1 || keys[0] != "PocketBase/Bookmarks/Same.txt" {
+		t.Errorf("stored %v, want only the recorded object", keys)
+	}
+}
+
+// saveGame saves a games record with the given cover URL.
+func saveGame(t *testing.T, app core.App, title, cover string) *core.Record {
+	t.Helper()
+	games, err := app.FindCollectionByNameOrId("games")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := core.NewRecord(games)
+	game.Set("title", title)
+	game.Set("cover", cover)
+	if err := app.Save(game); err != nil {
+		t.Fatal(err)
+	}
+	return game
+}
+
+// storedKeys lists every object in the test app's storage.
+func storedKeys(t *testing.T, assets *assetStore) []string {
+	t.Helper()
+	keys, err := assets.store.List(gcPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestReleaseAssets(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	put := func(filename, content, parent string) string {
+		t.Helper()
+		url, err := assets.put("games", filename, strings.NewReader(content), "image/jpeg", parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return url
+	}
+
+	shared := put("Shared.jpeg", "shared cover", "")
+	put("Shared-extra.jpeg", "accompanies the shared cover", shared)
+	first := saveGame(t, app, "First", shared)
+	saveGame(t, app, "Second", shared)
+
+	if err := app.Delete(first); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(storedKeys(t, assets)); got != 2 {
+		t.Fatalf("after deleting one of two referencing records: %d objects, want 2", got)
+	}
+
+	second, err := app.FindFirstRecordByData("games", "title", "Second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacement := put("Replacement.jpeg", "new cover", "")
+	second.Set("cover", replacement)
+	if err := app.Save(second); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := storedKeys(t, assets)
+	if len(keys) != 1 || !strings.Contains(keys[0], "Replacement-") {
+		t.Fatalf("after replacing the cover: objects %v, want only the replacement", keys)
+	}
+
+	if err := app.Delete(second); err != nil {
+		t.Fatal(err)
+	}
+	if keys := storedKeys(t, assets); len(keys) != 0 {
+		t.Errorf("after deleting the last record: objects %v, want none", keys)
+	}
+	if total, err := app.CountRecords(assetsCollection); err != nil || total != 0 {
+		t.Errorf("_assets has %d records (%v), want 0", total, err)
+	}
+}
+
+// pngCover encodes a blank width×height PNG.
+func pngCover(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadCover(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg") // wrong on purpose: the content decides
+		w.Write(pngCover(t, 2000, 3000))
+	}))
+	defer srv.Close()
+
+	url, err := uploadCover(assets, srv.URL+"/cover", "games", "Normalized.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(url, ".jpeg") {
+		t.Errorf("cover URL = %q, want a .jpeg", url)
+	}
+
+	keys := storedKeys(t, assets)
+	if len(keys) != 3 {
+		t.Fatalf("stored %v, want the cover and two thumbnails", keys)
+	}
+	var thumbs int
+	for _, key := range keys {
+		if strings.HasSuffix(key, "-small.jpeg") || strings.HasSuffix(key, "-medium.jpeg") {
+			thumbs++
+		}
+	}
+	if thumbs != 2 {
+		t.Errorf("stored %v, want -small and -medium thumbnails", keys)
+	}
+
+	again, err := uploadCover(assets, srv.URL+"/cover", "games", "Normalized.png")
+	if err != nil || again != url {
+		t.Errorf("re-upload = %q, %v; want the stored %q", again, err, url)
+	}
+
+	game := saveGame(t, app, "Normalized", url)
+	if err := app.Delete(game); err != nil {
+		t.Fatal(err)
+	}
+	if keys := storedKeys(t, assets); len(keys) != 0 {
+		t.Errorf("after deleting the record: objects %v, want the thumbnails released too", keys)
+	}
+}
+
+func TestUploadSmallCover(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	// Covers aren't scaled up: both thumbnails have the cover's bytes.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pngCover(t, 120, 180))
+	}))
+	defer srv.Close()
+
+	url, err := uploadCover(assets, srv.URL+"/cover", "games", "Small.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := saveGame(t, app, "Small", url)
+
+	keys := storedKeys(t, assets)
+	if len(keys) != 3 {
+		t.Fatalf("stored %v, want the cover and both thumbnails", keys)
+	}
+	if total, err := app.CountRecords(assetsCollection); err != nil || total != 1 {
+		t.Errorf("_assets has %d records (%v), want only the cover", total, err)
+	}
+
+	report, err := collectGarbage(app, assets, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Orphans) != 0 {
+		t.Errorf("gc orphans %v, want the thumbnails kept with their cover", report.Orphans)
+	}
+
+	if err := app.Delete(game); err != nil {
+		t.Fatal(err)
+	}
+	if keys := storedKeys(t, assets); len(keys) != 0 {
+		t.Errorf("after deleting the record: objects %v, want the thumbnails released too", keys)
+	}
+}
+
+func TestUploadCoverThumbMatchesAsset(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	data := pngCover(t, 2000, 3000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	// An unrelated asset that happens to have the small thumbnail's bytes.
+	cover, err := helpers.NormalizeCover(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := assets.put("games", "Other.jpeg", bytes.NewReader(cover.Thumbs["small"]), "image/jpeg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveGame(t, app, "Other", other)
+
+	url, err := uploadCover(assets, srv.URL+"/cover", "games", "Cover.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := saveGame(t, app, "Cover", url)
+
+	if keys := storedKeys(t, assets); len(keys) != 4 {
+		t.Fatalf("stored %v, want the other asset, the cover and both thumbnails", keys)
+	}
+	if total, err := app.CountRecords(assetsCollection); err != nil || total != 3 {
+		t.Errorf("_assets has %d records (%v), want the other asset, the cover and the medium thumbnail", total, err)
+	}
+
+	if err := app.Delete(game); err != nil {
+		t.Fatal(err)
+	}
+	keys := storedKeys(t, assets)
+	if len(keys) != 1 || !strings.Contains(keys[0], "Other-") {
+		t.Errorf("after deleting the record: objects %v, want only the other asset", keys)
+	}
+}
+
+func TestCheckAssets(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone.jpeg" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte("external cover"))
+	}))
+	defer srv.Close()
+
+	stored, err := assets.put("games", "Stored.jpeg", strings.NewReader("stored cover"), "image/jpeg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost, err := assets.put("games", "Lost.jpeg", strings.NewReader("lost cover"), "image/jpeg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lostKey, err := assets.keyFor(lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := assets.store.Delete(lostKey); err != nil {
+		t.Fatal(err)
+	}
+
+	saveGame(t, app, "Stored", stored)
+	lostGame := saveGame(t, app, "Lost", lost)
+	saveGame(t, app, "External", srv.URL+"/cover.jpeg")
+	goneGame := saveGame(t, app, "Gone", srv.URL+"/gone.jpeg")
+	saveGame(t, app, "No cover", "")
+
+	for run := 1; run <= 2; run++ {
+		report, err := checkAssets(app, assets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Checked != 4 || len(report.Broken) != 2 {
+			t.Fatalf("run %d: %d checked, %d broken; want 4 and 2", run, report.Checked, len(report.Broken))
+		}
+
+		rows, err := app.FindAllRecords(assetChecksCollection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("run %d: %d _asset_checks rows, want 2", run, len(rows))
+		}
+		for _, row := range rows {
+			if row.GetInt("status") != http.StatusNotFound || row.GetInt("failures") != run {
+				t.Errorf("run %d: %s status %d, failures %d; want 404, %d", run, row.GetString("record"), row.GetInt("status"), row.GetInt("failures"), run)
+			}
+		}
+	}
+
+	if asset, err := assets.find("url", lost); err != nil || asset != nil {
+		t.Errorf("missing object still in _assets (%v), so re-archiving would reuse it", err)
+	}
+
+	broken, err := brokenRecords(app, "games")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(broken) != 2 || !broken[lostGame.Id] || !broken[goneGame.Id] {
+		t.Errorf("brokenRecords = %v, want the lost and gone games", broken)
+	}
+
+	// Re-archived and deleted records are cleared on the next run.
+	replacement, err := assets.put("games", "Lost.jpeg", strings.NewReader("lost cover"), "image/jpeg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lostGame, err = app.FindRecordById("games", lostGame.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lostGame.Set("cover", replacement)
+	if err := app.Save(lostGame); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(goneGame); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := checkAssets(app, assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Broken) != 0 {
+		t.Errorf("after re-archiving: %d broken, want 0", len(report.Broken))
+	}
+	if total, err := app.CountRecords(assetChecksCollection); err != nil || total != 0 {
+		t.Errorf("_asset_checks has %d records (%v), want 0", total, err)
+	}
+}
+
+func TestClassifyLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   linkOutcome
+	}{
+		{"ok", http.StatusOK, nil, linkOK},
+		{"not modified", http.StatusNotModified, nil, linkOK},
+		{"not found", http.StatusNotFound, nil, linkBroken},
+		{"gone", http.StatusGone, nil, linkBroken},
+		{"server error", http.StatusBadGateway, nil, linkBroken},
+		{"no response", 0, fmt.Errorf("dial tcp: no such host"), linkBroken},
+		{"bot wall", http.StatusForbidden, nil, linkInconclusive},
+		{"login required", http.StatusUnauthorized, nil, linkInconclusive},
+		{"rate limited", http.StatusTooManyRequests, nil, linkInconclusive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyLink(tt.status, tt.err); got.Outcome != tt.want {
+				t.Errorf("classifyLink(%d, %v) = %v, want %v", tt.status, tt.err, got.Outcome, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	app, _ := newTestAppWithAssets(t)
+	defer app.Cleanup()
+	if err := app.Save(schema.FeedsCollection()); err != nil {
+		t.Fatal(err)
+	}
+
+	var up atomic.Bool // whether /flaky answers
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/head-404":
+			if r.Method == http.MethodHead {
+				http.NotFound(w, r)
+			}
+		case "/blocked":
+			w.WriteHeader(http.StatusForbidden)
+		case "/flaky":
+			if !up.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/ok":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tag, err := app.FindFirstRecordByData("meta", "name", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	save := func(collection, title string, fields map[string]any) *core.Record {
+		t.Helper()
+		c, err := app.FindCollectionByNameOrId(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := core.NewRecord(c)
+		r.Load(map[string]any{"title": title, "tags": []string{tag.Id}, "type": "websites"})
+		if collection == "bookmarks" {
+			r.Load(map[string]any{"creator": "me", "type": "articles"})
+		}
+		r.Load(fields)
+		if err := app.Save(r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	moved := save("bookmarks", "Moved", map[string]any{"url": srv.URL + "/moved"})
+	headOnly := save("bookmarks", "HEAD 404", map[string]any{"url": srv.URL + "/head-404"})
+	blocked := save("bookmarks", "Blocked", map[string]any{"url": srv.URL + "/blocked", "link_failures": 1})
+	flaky := save("bookmarks", "Flaky", map[string]any{"url": srv.URL + "/flaky"})
+	feed := save("feeds", "Feed", map[string]any{"url": srv.URL + "/ok", "rss": srv.URL + "/feed.xml"})
+
+	const deadAfter = 2
+	for run := 1; run <= deadAfter; run++ {
+		report, err := checkLinks(app, deadAfter, probeLink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Checked != 5 || len(report.Broken) != 2 {
+			t.Fatalf("run %d: %d checked, %d broken; want 5 and 2", run, report.Checked, len(report.Broken))
+		}
+	}
+
+	get := func(r *core.Record) *core.Record {
+		t.Helper()
+		fresh, err := app.FindRecordById(r.Collection().Name, r.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fresh
+	}
+
+	for _, tt := range []struct {
+		record   *core.Record
+		status   int
+		failures int
+		dead     bool
+	}{
+		{moved, http.StatusOK, 0, false},
+		{headOnly, http.StatusOK, 0, false},
+		{blocked, http.StatusForbidden, 1, false},
+		{flaky, http.StatusServiceUnavailable, 2, true},
+		{feed, http.StatusNotFound, 2, true},
+	} {
+		r := get(tt.record)
+		if r.GetInt("link_status") != tt.status || r.GetInt("link_failures") != tt.failures || r.GetBool("dead") != tt.dead {
+			t.Errorf("%s: status %d, failures %d, dead %v; want %d, %d, %v",
+				r.GetString("title"), r.GetInt("link_status"), r.GetInt("link_failures"), r.GetBool("dead"), tt.status, tt.failures, tt.dead)
+		}
+		if r.GetDateTime("link_checked").IsZero() {
+			t.Errorf("%s: link_checked not set", r.GetString("title"))
+		}
+	}
+	if got := get(feed).GetString("link_error"); !strings.HasPrefix(got, "rss: ") {
+		t.Errorf("feed link_error = %q, want the rss failure", got)
+	}
+
+	up.Store(true)
+	report, err := checkLinks(app, deadAfter, probeLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Revived != 1 {
+		t.Errorf("revived %d, want the flaky bookmark", report.Revived)
+	}
+	if r := get(flaky); r.GetBool("dead") || r.GetInt("link_failures") != 0 {
+		t.Errorf("flaky bookmark back up: dead %v, failures %d; want false, 0", r.GetBool("dead"), r.GetInt("link_failures"))
+	}
+}
+
+func TestCheckLinksKeepsConcurrentEdits(t *testing.T) {
+	app, _ := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	tag, err := app.FindFirstRecordByData("meta", "name", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookmarks, err := app.FindCollectionByNameOrId("bookmarks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	save := func(title, url string) *core.Record {
+		t.Helper()
+		r := core.NewRecord(bookmarks)
+		r.Load(map[string]any{"title": title, "creator": "me", "type": "articles", "tags": []string{tag.Id}, "url": url})
+		if err := app.Save(r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	enriched := save("Enriched", "https://example.com/enriched")
+	moved := save("Moved", "https://example.com/moved")
+
+	// An enrichment job and an edit land while the links are being probed.
+	probe := func(url string) (int, error) {
+		var id string
+		fields := map[string]any{}
+		switch url {
+		case "https://example.com/enriched":
+			id, fields["archive"] = enriched.Id, "https://cdn.example.com/enriched.md"
+		case "https://example.com/moved":
+			id, fields["url"] = moved.Id, "https://example.com/new-home"
+		}
+		r, err := app.FindRecordById("bookmarks", id)
+		if err != nil {
+			return 0, err
+		}
+		r.Load(fields)
+		if err := app.Save(r); err != nil {
+			return 0, err
+		}
+		return http.StatusNotFound, nil
+	}
+
+	if _, err := checkLinks(app, 3, probe); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := app.FindRecordById("bookmarks", enriched.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.GetString("archive"); got != "https://cdn.example.com/enriched.md" {
+		t.Errorf("archive written during the run = %q, want it kept", got)
+	}
+	if r.GetInt("link_failures") != 1 || r.GetInt("link_status") != http.StatusNotFound {
+		t.Errorf("link_failures %d, link_status %d; want 1, 404", r.GetInt("link_failures"), r.GetInt("link_status"))
+	}
+	if !r.GetDateTime("updated").Before(r.GetDateTime("link_checked")) {
+		t.Errorf("updated %s bumped by the check at %s", r.GetDateTime("updated"), r.GetDateTime("link_checked"))
+	}
+
+	r, err = app.FindRecordById("bookmarks", moved.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.GetString("url") != "https://example.com/new-home" || r.GetInt("link_failures") != 0 || !r.GetDateTime("link_checked").IsZero() {
+		t.Errorf("moved bookmark: url %q, link_failures %d, link_checked %s; want the new URL left unchecked",
+			r.GetString("url"), r.GetInt("link_failures"), r.GetDateTime("link_checked"))
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	live, err := assets.put("games", "Live.jpeg", strings.NewReader("live"), "image/jpeg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveGame(t, app, "Live", live)
+	if _, err := assets.put("games", "Orphan.jpeg", strings.NewReader("orphan"), "image/jpeg", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Uploaded before _assets existed: matched by public URL only.
+	legacy, err := assets.store.Put(helpers.ObjectKey("games", "Legacy.jpeg"), strings.NewReader("legacy"), -1, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveGame(t, app, "Legacy", legacy.URL)
+	if _, err := assets.store.Put(helpers.ObjectKey("games", "Stray.jpeg"), strings.NewReader("stray"), -1, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tracked, but deleted from storage behind the app's back.
+	gone, err := assets.put("games", "Gone.jpeg", strings.NewReader("gone"), "image/jpeg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goneAsset, err := assets.find("url", gone)
+	if err != nil || goneAsset == nil {
+		t.Fatalf("find(%q) = %v, %v", gone, goneAsset, err)
+	}
+	if err := assets.store.Delete(goneAsset.GetString("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := collectGarbage(app, assets, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Objects != 4 || len(report.Orphans) != 2 || len(report.Missing) != 1 {
+		t.Fatalf("report = %+v, want 4 objects, 2 orphans, 1 missing", report)
+	}
+	if got := len(storedKeys(t, assets)); got != 4 {
+		t.Fatalf("report-only run left %d objects, want 4", got)
+	}
+
+	if _, err := collectGarbage(app, assets, true); err != nil {
+		t.Fatal(err)
+	}
+	keys := storedKeys(t, assets)
+	if len(keys) != 2 {
+		t.Errorf("after --delete: objects %v, want the live and legacy covers", keys)
+	}
+	if total, err := app.CountRecords(assetsCollection); err != nil || total != 1 {
+		t.Errorf("_assets has %d records (%v), want 1", total, err)
+	}
+}
+
+// signingStorage is local storage posing as a private bucket: downloads need a
+// "signed" URL.
+type signingStorage struct {
+	*helpers.LocalStorage
+}
+
+func (signingStorage) Private() bool { return true }
+
+func (s signingStorage) SignedURL(key string, ttl time.Duration) (string, error) {
+	return fmt.Sprintf("%s?sig=%d", s.PublicURL(key), int(ttl.Seconds())), nil
+}
+
+func TestServeAsset(t *testing.T) {
+	const gameID = "archivedgame001"
+	headers := map[string]string{}
+
+	// factory returns a test app with one game whose cover is stored in a private
+	// (signingStorage) or public backend, and fills headers with a user's token.
+	factory := func(private bool) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, assets := newTestAppWithAssets(t)
+			if private {
+				assets.store = signingStorage{assets.store.(*helpers.LocalStorage)}
+			}
+
+			cover, err := assets.put("games", "Cover.jpeg", strings.NewReader("cover"), "image/jpeg", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			games, err := app.FindCollectionByNameOrId("games")
+			if err != nil {
+				t.Fatal(err)
+			}
+			game := core.NewRecord(games)
+			game.Id = gameID
+			game.Set("title", "Archived")
+			game.Set("cover", cover)
+			if err := app.Save(game); err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := app.FindAuthRecordByEmail("users", "test@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := user.NewAuthToken()
+			if err != nil {
+				t.Fatal(err)
+			}
+			headers["Authorization"] = token
+
+			return app
+		}
+	}
+
+	// expectLocation checks the redirect target, which isn't part of the response body.
+	expectLocation := func(contains, excludes string) func(t testing.TB, app *tests.TestApp, res *http.Response) {
+		return func(t testing.TB, app *tests.TestApp, res *http.Response) {
+			location := res.Header.Get("Location")
+			if !strings.Contains(location, "PocketBase/Games/Cover-") || !strings.Contains(location, contains) {
+				t.Errorf("Location = %q, want the cover with %q", location, contains)
+			}
+			if excludes != "" && strings.Contains(location, excludes) {
+				t.Errorf("Location = %q, must not contain %q", location, excludes)
+			}
+		}
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "guest can't see a record behind the view rule",
+			Method:          http.MethodGet,
+			URL:             "/api/rivendell/archive/games/" + gameID + "/cover",
+			ExpectedStatus:  404,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  factory(true),
+		},
+		{
+			Name:           "user is redirected to a signed URL",
+			Method:         http.MethodGet,
+			URL:            "/api/rivendell/archive/games/" + gameID + "/cover",
+			Headers:        headers,
+			ExpectedStatus: 307,
+			TestAppFactory: factory(true),
+			AfterTestFunc:  expectLocation("?sig=600", ""),
+		},
+		{
+			Name:           "public storage redirects to the stored URL",
+			Method:         http.MethodGet,
+			URL:            "/api/rivendell/archive/games/" + gameID + "/cover",
+			Headers:        headers,
+			ExpectedStatus: 307,
+			TestAppFactory: factory(false),
+			AfterTestFunc:  expectLocation("http://127.0.0.1:8090/storage/", "?sig="),
+		},
+		{
+			Name:            "fields that don't hold assets are not served",
+			Method:          http.MethodGet,
+			URL:             "/api/rivendell/archive/games/" + gameID + "/title",
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  factory(true),
+		},
+		{
+			Name:            "missing record",
+			Method:          http.MethodGet,
+			URL:             "/api/rivendell/archive/games/missingrecord01/cover",
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  factory(true),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestKeyFor(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	tracked, err := assets.put("games", "Tracked Cover.jpeg", strings.NewReader("tracked"), "image/jpeg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"tracked asset", tracked, "PocketBase/Games/Tracked Cover-"},
+		{"untracked upload", assets.store.PublicURL("PocketBase/Books/The Hobbit.jpeg"), "PocketBase/Books/The Hobbit.jpeg"},
+		{"external URL", "https://covers.example.com/x.jpeg", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := assets.keyFor(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (tt.want == "" && got != "") || !strings.HasPrefix(got, tt.want) {
+				t.Errorf("keyFor(%q) = %q, want prefix %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertRecord(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	cover, err := assets.put("games", "Cover.jpeg", strings.NewReader("cover"), "image/jpeg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game, err := app.FindRecordById("games", saveGame(t, app, "Converted", cover).Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !needsConversion(game) {
+		t.Fatal("needsConversion = false for a record with only a cover URL")
+	}
+
+	saved, err := applyEnricher(app, func(r *core.Record) (bool, error) {
+		return convertRecord(assets, r, true)
+	}, game)
+	if err != nil || !saved {
+		t.Fatalf("convert = %v, %v; want saved", saved, err)
+	}
+
+	game, err = app.FindRecordById("games", game.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := game.GetString("cover_file")
+	if !strings.HasPrefix(name, "cover_") || game.GetString("cover") != "" {
+		t.Errorf("cover_file = %q, cover = %q; want an attached file and no URL", name, game.GetString("cover"))
+	}
+	if needsConversion(game) {
+		t.Error("needsConversion = true after converting")
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+	if ok, err := fsys.Exists(game.BaseFilesPath() + "/" + name); err != nil || !ok {
+		t.Errorf("attached file exists = %v, %v; want true", ok, err)
+	}
+
+	if keys := storedKeys(t, assets); len(keys) != 0 {
+		t.Errorf("clearing the URL left objects %v in storage", keys)
+	}
+	assets.spoolMu.Lock()
+	defer assets.spoolMu.Unlock()
+	if len(assets.spooled) != 0 {
+		t.Errorf("spooled temp files left after save: %v", assets.spooled)
+	}
+}
+
+func TestConvertOnMigrate(t *testing.T) {
+	for _, files := range []bool{false, true} {
+		t.Run(fmt.Sprintf("files=%v", files), func(t *testing.T) {
+			app, assets := newTestAppWithAssets(t)
+			defer app.Cleanup()
+			assets.files = files
+
+			cover, err := assets.put("games", "Cover.jpeg", strings.NewReader("cover"), "image/jpeg", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			game := saveGame(t, app, "Converted", cover)
+
+			// Migrations run inside a transaction.
+			err = app.RunInTransaction(func(txApp core.App) error {
+				return convertOnMigrate(assets)(txApp)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			game, err = app.FindRecordById("games", game.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attached := game.GetString("cover_file") != ""; attached != files {
+				t.Errorf("cover_file = %q, attached %v; want %v", game.GetString("cover_file"), attached, files)
+			}
+			if game.GetString("cover") != cover {
+				t.Errorf("cover = %q, want the URL kept", game.GetString("cover"))
+			}
+		})
+	}
+}
+
+func TestApplyPatchFileMode(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+	assets.files = true
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pngCover(t, 800, 1200))
+	}))
+	defer srv.Close()
+
+	game, err := app.FindRecordById("games", saveGame(t, app, "Attached", "").Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := Patch{Assets: []Asset{{Field: "cover", URL: srv.URL + "/cover.jpeg", Filename: "Attached.jpeg"}}}
+	saved, err := applyEnricher(app, func(r *core.Record) (bool, error) {
+		return applyPatch(assets, r, patch)
+	}, game)
+	if err != nil || !saved {
+		t.Fatalf("applyPatch = %v, %v; want saved", saved, err)
+	}
+
+	game, err = app.FindRecordById("games", game.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(game.GetString("cover_file"), "attached_") || game.GetString("cover") != "" {
+		t.Errorf("cover_file = %q, cover = %q; want the file attached and no URL", game.GetString("cover_file"), game.GetString("cover"))
+	}
+	if keys := storedKeys(t, assets); len(keys) != 0 {
+		t.Errorf("file mode uploaded %v to storage", keys)
+	}
+}
+
+func TestKeptArtifact(t *testing.T) {
+	primary := archiveArtifact{Kind: archiveMarkdown, Status: artifactOK, Hash: "aaaa"}
+	stored := archiveArtifact{Kind: archiveWARC, Status: artifactOK, URL: "https://storage/a.warc"}
+	attached := archiveArtifact{Kind: archiveWARC, Status: artifactOK, Field: "warc_file", File: "a_x1.warc"}
+	wayback := archiveArtifact{Kind: archiveWayback, Status: artifactOK, URL: "https://web.archive.org/web/1/https://example.com"}
+	failed := failedArtifact(archiveWARC, errors.New("timeout"))
+	changed := primary
+	changed.Hash = "bbbb"
+
+	cases := []struct {
+		name     string
+		previous []archiveArtifact
+		kind     string
+		files    bool
+		want     bool
+	}{
+		{"stored with the same content", []archiveArtifact{primary, stored}, archiveWARC, false, true},
+		{"content changed", []archiveArtifact{changed, stored}, archiveWARC, false, false},
+		{"failed last time", []archiveArtifact{primary, failed}, archiveWARC, false, false},
+		{"never captured", []archiveArtifact{primary}, archiveWARC, false, false},
+		{"no previous list", nil, archiveWARC, false, false},
+		{"stored by URL, now in file mode", []archiveArtifact{primary, stored}, archiveWARC, true, false},
+		{"attached in file mode", []archiveArtifact{primary, attached}, archiveWARC, true, true},
+		{"attached, now stored by URL", []archiveArtifact{primary, attached}, archiveWARC, false, false},
+		{"wayback in either mode", []archiveArtifact{primary, wayback}, archiveWayback, true, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := keptArtifact(c.previous, primary, c.kind, c.files)
+			if ok != c.want {
+				t.Fatalf("keptArtifact() ok = %v, want %v", ok, c.want)
+			}
+			if ok && got.Kind != c.kind {
+				t.Errorf("keptArtifact() = %+v, want the previous %s", got, c.kind)
+			}
+		})
+	}
+}
+
+func TestConvertArchiveArtifacts(t *testing.T) {
+	app, assets := newTestAppWithAssets(t)
+	defer app.Cleanup()
+
+	markdown, err := assets.putAsset("bookmarks", "Articles/Converted.md", strings.NewReader("# Converted"), "text/markdown", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := assets.putAsset("bookmarks", "Articles/Converted.html", strings.NewReader("<html></html>"), "text/html", markdown.GetString("url"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err := app.FindFirstRecordByData("meta", "name", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookmarks, err := app.FindCollectionByNameOrId("bookmarks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookmark := core.NewRecord(bookmarks)
+	bookmark.Load(map[string]any{
+		"title":   "Converted",
+		"creator": "me",
+		"url":     "https://example.com/converted",
+		"type":    "articles",
+		"tags":    []string{tag.Id},
+		"archive": markdown.GetString("url"),
+		"archives": []archiveArtifact{
+			assetArtifact(archiveMarkdown, markdown),
+			assetArtifact(archiveSingleFile, snapshot),
+			failedArtifact(archiveWARC, errors.New("timeout")),
+		},
+	})
+	if err := app.Save(bookmark); err != nil {
+		t.Fatal(err)
+	}
+	if !hasFailedArtifacts(bookmark) {
+		t.Error("hasFailedArtifacts = false with a failed WARC")
+	}
+
+	if _, err := applyEnricher(app, func(r *core.Record) (bool, error) {
+		return convertRecord(assets, r, true)
+	}, bookmark); err != nil {
+		t.Fatal(err)
+	}
+
+	bookmark, err = app.FindRecordById("bookmarks", bookmark.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts := recordArtifacts(bookmark)
+	if len(artifacts) != 3 {
+		t.Fatalf("archives = %+v, want 3 artifacts", artifacts)
+	}
+	for i, field := range []string{"archive_file", "snapshot_file"} {
+		a := artifacts[i]
+		if a.Field != field || a.File != bookmark.GetString(field) || a.File == "" || a.URL != "" {
+			t.Errorf("%s artifact = %+v, want it attached as %s %q without a URL", a.Kind, a, field, bookmark.GetString(field))
+		}
+		if a.Hash == "" || a.Size == 0 {
+			t.Errorf("%s artifact lost its hash or size: %+v", a.Kind, a)
+		}
+	}
+	if warc := artifacts[2]; warc.Status != artifactFailed || warc.File != "" {
+		t.Errorf("failed WARC artifact = %+v, want it left as failed", warc)
+	}
+}
+
+func TestExtractionRules(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	rules, err := extractionRules(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wired, ok := helpers.MatchRule(rules, "www.wired.com")
+	if !ok || len(wired.Remove) == 0 || len(wired.Replace) != 1 || wired.Replace[0].Pattern != "—+" {
+		t.Errorf("seeded wired.com rule = %+v, %v; want its selectors and the em dash replacement", wired, ok)
+	}
+	for _, host := range []string{"theatlantic.com", "arstechnica.com"} {
+		if rule, ok := helpers.MatchRule(rules, host); !ok || len(rule.Remove) == 0 {
+			t.Errorf("seeded %s rule = %+v, %v; want its selectors", host, rule, ok)
+		}
+	}
+
+	collection, err := app.FindCollectionByNameOrId(extractionRulesCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	save := func(fields map[string]any) error {
+		rule := core.NewRecord(collection)
+		rule.Load(fields)
+		return app.Save(rule)
+	}
+
+	if err := save(map[string]any{"host": "example.com", "keep": []string{"div.post-body"}, "keep_images": true}); err != nil {
+		t.Errorf("saving a valid rule: %v", err)
+	}
+	for field, value := range map[string]any{
+		"remove":  []string{"div[class^='Sidebar'"},
+		"keep":    []string{"p >"},
+		"replace": []helpers.Replacement{{Pattern: "(unclosed"}},
+	} {
+		err := save(map[string]any{"host": "invalid-" + field + ".com", field: value})
+		var errs validation.Errors
+		if !errors.As(err, &errs) || errs[field] == nil {
+			t.Errorf("saving an invalid %s = %v, want a %s field error", field, err, field)
+		}
+	}
+
+	rules, err = extractionRules(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule, ok := helpers.MatchRule(rules, "blog.example.com"); !ok || !rule.KeepImages || len(rule.Keep) != 1 {
+		t.Errorf("example.com rule = %+v, %v; want the saved rule", rule, ok)
+	}
+}
+
+func TestAdoptAssets(t *testing.T) {
+	put := func(t *testing.T, assets *assetStore, filename, content, contentType, parent string) string {
+		t.Helper()
+		url, err := assets.put("bookmarks", filename, strings.NewReader(content), contentType, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return url
+	}
+	parents := func(t *testing.T, assets *assetStore, want map[string][2]string) {
+		t.Helper()
+		for url, want := range want {
+			asset, err := assets.find("url", url)
+			if err != nil || asset == nil {
+				t.Fatalf("find(%q) = %v, %v", url, asset, err)
+			}
+			owners := strings.Join(assetOwners(asset), ",")
+			if got := asset.GetString("parent"); got != want[0] || owners != want[1] {
+				t.Errorf("%s parent %q, owners %q; want %q, %q", asset.GetString("key"), got, owners, want[0], want[1])
+			}
+		}
+	}
+	articleImages := func(t *testing.T, assets *assetStore) []string {
+		t.Helper()
+		var keys []string
+		for _, key := range storedKeys(t, assets) {
+			if strings.Contains(key, "Articles/") && strings.HasSuffix(key, ".png") {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+
+	t.Run("one article", func(t *testing.T) {
+		app, assets := newTestAppWithAssets(t)
+		defer app.Cleanup()
+
+		oldArchive := put(t, assets, "Articles/Article.md", "first version", "text/markdown", "")
+		archive := put(t, assets, "Articles/Article.md", "second version", "text/markdown", "")
+		cover := put(t, assets, "Cover.jpeg", "cover", "image/jpeg", "")
+		saveGame(t, app, "Game", cover)
+
+		image := put(t, assets, "Articles/Article/image-01.png", "image", "image/png", "")
+		previous := put(t, assets, "Articles/Article/image-02.png", "kept from the last archive", "image/png", oldArchive)
+		thumb := put(t, assets, "Cover-small.jpeg", "thumbnail", "image/jpeg", cover)
+
+		if err := assets.adopt([]string{image, previous, cover, thumb}, archive, oldArchive); err != nil {
+			t.Fatal(err)
+		}
+		parents(t, assets, map[string][2]string{image: {archive, ""}, previous: {archive, ""}, cover: {"", ""}, thumb: {cover, ""}})
+
+		if err := assets.release(oldArchive); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(articleImages(t, assets)); got != 2 {
+			t.Errorf("%d images left after releasing the replaced archive, want 2", got)
+		}
+		if err := assets.release(archive); err != nil {
+			t.Fatal(err)
+		}
+		if keys := articleImages(t, assets); len(keys) != 0 {
+			t.Errorf("%v left behind after releasing the archives", keys)
+		}
+	})
+
+	t.Run("two articles sharing an image", func(t *testing.T) {
+		app, assets := newTestAppWithAssets(t)
+		defer app.Cleanup()
+
+		first := put(t, assets, "Articles/First.md", "first article", "text/markdown", "")
+		image := put(t, assets, "Articles/First/image-01.png", "shared image", "image/png", "")
+		if err := assets.adopt([]string{image}, first, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// The second article's mirror gets the first one's copy back from put.
+		second := put(t, assets, "Articles/Second.md", "second article", "text/markdown", "")
+		if again := put(t, assets, "Articles/Second/image-01.png", "shared image", "image/png", ""); again != image {
+			t.Fatalf("put returned %q for the same image, want %q", again, image)
+		}
+		if err := assets.adopt([]string{image}, second, ""); err != nil {
+			t.Fatal(err)
+		}
+		parents(t, assets, map[string][2]string{image: {first, second}})
+
+		// Re-archiving the second article hands its share to the new archive.
+		updated := put(t, assets, "Articles/Second.md", "second article, updated", "text/markdown", "")
+		if err := assets.adopt([]string{image}, updated, second); err != nil {
+			t.Fatal(err)
+		}
+		if err := assets.release(second); err != nil {
+			t.Fatal(err)
+		}
+		parents(t, assets, map[string][2]string{image: {first, updated}})
+
+		// Only the second bookmark is left: gc keeps the image for it.
+		tag, err := app.FindFirstRecordByData("meta", "name", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookmarks, err := app.FindCollectionByNameOrId("bookmarks")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookmark := core.NewRecord(bookmarks)
+		bookmark.Load(map[string]any{"title": "Second", "creator": "me", "type": "articles", "tags": []string{tag.Id}, "url": "https://example.com/second", "archive": updated})
+		if err := app.Save(bookmark); err != nil {
+			t.Fatal(err)
+		}
+		report, err := collectGarbage(app, assets, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Orphans) != 1 || !strings.Contains(report.Orphans[0], "Articles/First-") {
+			t.Errorf("gc orphans %v, want only the first article's archive", report.Orphans)
+		}
+
+		if err := assets.release(first); err != nil {
+			t.Fatal(err)
+		}
+		parents(t, assets, map[string][2]string{image: {updated, ""}})
+		if got := len(articleImages(t, assets)); got != 1 {
+			t.Fatalf("%d images after releasing the first article, want the shared one kept", got)
+		}
+
+		if err := app.Delete(bookmark); err != nil {
+			t.Fatal(err)
+		}
+
+		if keys := articleImages(t, assets); len(keys) != 0 {
+			t.Errorf("%v left behind after deleting both articles", keys)
+		}
+	})
+
+	t.Run("two articles sharing a snapshot", func(t *testing.T) {
+		app, assets := newTestAppWithAssets(t)
+		defer app.Cleanup()
+
+		first := put(t, assets, "Articles/First.md", "first article", "text/markdown", "")
+		snapshot := put(t, assets, "Articles/First.html", "same page", "text/html", first)
+
+		// put hands the second archive the first one's snapshot and shares it.
+		second := put(t, assets, "Articles/Second.md", "second article", "text/markdown", "")
+		if again := put(t, assets, "Articles/Second.html", "same page", "text/html", second); again != snapshot {
+			t.Fatalf("put returned %q for the same snapshot, want %q", again, snapshot)
+		}
+		parents(t, assets, map[string][2]string{snapshot: {first, second}})
+
+		if err := assets.release(first); err != nil {
+			t.Fatal(err)
+		}
+		parents(t, assets, map[string][2]string{snapshot: {second, ""}})
+
+		// A bookmark listing the snapshot in its archives keeps it once the archive
+		// it accompanies is released.
+		tag, err := app.FindFirstRecordByData("meta", "name", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookmarks, err := app.FindCollectionByNameOrId("bookmarks")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookmark := core.NewRecord(bookmarks)
+		bookmark.Load(map[string]any{"title": "Second", "creator": "me", "type": "articles", "tags": []string{tag.Id}, "url": "https://example.com/second", "archive": second})
+		bookmark.Set("archives", []archiveArtifact{{Kind: archiveSingleFile, Status: artifactOK, URL: snapshot}})
+		if err := app.Save(bookmark); err != nil {
+			t.Fatal(err)
+		}
+		bookmark, err = app.FindRecordById("bookmarks", bookmark.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookmark.Set("archive", "")
+		if err := app.Save(bookmark); err != nil {
+			t.Fatal(err)
+		}
+		parents(t, assets, map[string][2]string{snapshot: {"", ""}})
+
+		report, err := collectGarbage(app, assets, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Orphans) != 0 {
+			t.Errorf("gc orphans %v, want the snapshot kept for the bookmark's archives", report.Orphans)
+		}
+	})
+}
+
+// errBrokenEnricher is a failure that isn't a provider error.
+var errBrokenEnricher = errors.New("broken")
+
+// stubEnricher returns a fixed patch or error, counting its lookups and recording
+// the IDs of the records it looked up.
+type stubEnricher struct {
+	name  string
+	patch Patch
+	err   error
+	calls atomic.Int32
+
+	mu   sync.Mutex
+	seen []string
+}
+
+func (s *stubEnricher) Name() string { return s.name }
+
+func (s *stubEnricher) Lookup(r *core.Record) (Patch, error) {
+	s.calls.Add(1)
+	s.mu.Lock()
+	s.seen = append(s.seen, r.Id)
+	s.mu.Unlock()
+	return s.patch, s.err
+}
+
+// newTestQueue returns a job queue running enricher for games, and a game to enqueue.
+func newTestQueue(t *testing.T, enricher Enricher) (*tests.TestApp, *jobQueue, *core.Record) {
+	t.Helper()
+	app, assets := newTestAppWithAssets(t)
+	reg := newRegistry(assets)
+	reg.Register("games", enricher)
+	return app, newJobQueue(app, reg), saveGame(t, app, "Astro Bot", "")
+}
+
+// findJob reloads a job record.
+func findJob(t *testing.T, app core.App, id string) *core.Record {
+	t.Helper()
+	job, err := app.FindRecordById(jobsCollection, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestJobQueueClaim(t *testing.T) {
+	app, queue, game := newTestQueue(t, &stubEnricher{name: "stub"})
+	defer app.Cleanup()
+
+	if err := queue.enqueue("games", game.Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.enqueue("games", game.Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := app.FindAllRecords(jobsCollection)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("jobs = %d, %v; want 2", len(jobs), err)
+	}
+	later := jobs[1]
+	later.Set("run_after", time.Now().Add(time.Hour))
+	if err := app.Save(later); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := queue.claim()
+	if err != nil || job == nil {
+		t.Fatalf("claim = %v, %v; want the due job", job, err)
+	}
+	if job.Id != jobs[0].Id {
+		t.Errorf("claimed %s, want the due job %s", job.Id, jobs[0].Id)
+	}
+	job = findJob(t, app, job.Id)
+	if job.GetString("status") != jobRunning || job.GetInt("attempts") != 1 {
+		t.Errorf("claimed job is %s after %d attempts, want running after 1", job.GetString("status"), job.GetInt("attempts"))
+	}
+
+	if job, err := queue.claim(); err != nil || job != nil {
+		t.Errorf("second claim = %v, %v; want nothing due", job, err)
+	}
+}
+
+func TestJobQueueRun(t *testing.T) {
+	transient := &helpers.ProviderError{Provider: "igdb", StatusCode: http.StatusServiceUnavailable, Err: errors.New("unavailable")}
+	maxAttempts := helpers.GetRetryPolicy("igdb").MaxAttempts
+
+	scenarios := []struct {
+		name     string
+		err      error
+		attempts int // attempts made before this one
+		status   string
+		provider string
+		retry    bool // run_after moved into the future
+	}{
+		{name: "success", status: jobDone},
+		{name: "transient failure", err: transient, status: jobFailed, provider: "igdb", retry: true},
+		{name: "retries exhausted", err: transient, attempts: maxAttempts - 1, status: jobDead, provider: "igdb"},
+		{name: "permanent failure", err: &helpers.ProviderError{Provider: "igdb", StatusCode: http.StatusNotFound, Err: errors.New("not found")}, status: jobDead, provider: "igdb"},
+		{name: "not a provider error", err: errors.New("broken"), status: jobDead},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			enricher := &stubEnricher{name: "igdb", patch: Patch{Year: 2024}, err: s.err}
+			app, queue, game := newTestQueue(t, enricher)
+			defer app.Cleanup()
+
+			if err := queue.enqueue("games", game.Id, nil); err != nil {
+				t.Fatal(err)
+			}
+			if s.attempts > 0 {
+				jobs, err := app.FindAllRecords(jobsCollection)
+				if err != nil || len(jobs) != 1 {
+					t.Fatalf("jobs = %d, %v; want 1", len(jobs), err)
+				}
+				jobs[0].Set("attempts", s.attempts)
+				if err := app.Save(jobs[0]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			job, err := queue.claim()
+			if err != nil || job == nil {
+				t.Fatalf("claim = %v, %v", job, err)
+			}
+			queue.run(job)
+
+			job = findJob(t, app, job.Id)
+			if job.GetString("status") != s.status {
+				t.Errorf("status = %q, want %q", job.GetString("status"), s.status)
+			}
+			if job.GetString("provider") != s.provider {
+				t.Errorf("provider = %q, want %q", job.GetString("provider"), s.provider)
+			}
+			if (job.GetString("last_error") != "") != (s.err != nil) {
+				t.Errorf("last_error = %q", job.GetString("last_error"))
+			}
+			if retry := job.GetDateTime("run_after").Time().After(time.Now()); retry != s.retry {
+				t.Errorf("run_after = %v, retry scheduled %v, want %v", job.GetDateTime("run_after"), retry, s.retry)
+			}
+			if job, err := queue.claim(); err != nil || job != nil {
+				t.Errorf("claim after run = %v, %v; want nothing due", job, err)
+			}
+
+			game, err = app.FindRecordById("games", game.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]int{true: 0, false: 2024}[s.err != nil]; game.GetInt("year") != want {
+				t.Errorf("year = %d, want %d", game.GetInt("year"), want)
+			}
+		})
+	}
+}
+
+func TestJobQueuePreserve(t *testing.T) {
+	enricher := &stubEnricher{name: "stub", patch: Patch{Year: 2024, Fields: map[string]any{"title": "ASTRO BOT", "publisher": "Sony"}}}
+	app, queue, game := newTestQueue(t, enricher)
+	defer app.Cleanup()
+
+	game.Set("title", "Astro Bot (edited)")
+	if err := app.Save(game); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.enqueue("games", game.Id, []string{"title"}); err != nil {
+		t.Fatal(err)
+	}
+	job, err := queue.claim()
+	if err != nil || job == nil {
+		t.Fatalf("claim = %v, %v", job, err)
+	}
+	queue.run(job)
+
+	game, err = app.FindRecordById("games", game.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.GetString("title") != "Astro Bot (edited)" {
+		t.Errorf("title = %q, want the preserved edit", game.GetString("title"))
+	}
+	if game.GetString("publisher") != "Sony" || game.GetInt("year") != 2024 {
+		t.Errorf("publisher, year = %q, %d; want the patch's", game.GetString("publisher"), game.GetInt("year"))
+	}
+	if status := findJob(t, app, job.Id).GetString("status"); status != jobDone {
+		t.Errorf("status = %q, want done", status)
+	}
+}
+
+// editingEnricher is a stubEnricher that saves an edit to the record while it's
+// looking it up, like a user updating the record during a slow enrichment.
+type editingEnricher struct {
+	stubEnricher
+	app  core.App
+	edit func(*core.Record)
+}
+
+func (s *editingEnricher) Lookup(r *core.Record) (Patch, error) {
+	current, err := s.app.FindRecordById(r.Collection(), r.Id)
+	if err != nil {
+		return Patch{}, err
+	}
+	s.edit(current)
+	if err := s.app.Save(current); err != nil {
+		return Patch{}, err
+	}
+	return s.stubEnricher.Lookup(r)
+}
+
+func TestJobQueueKeepsConcurrentEdits(t *testing.T) {
+	enricher := &editingEnricher{
+		stubEnricher: stubEnricher{name: "stub", patch: Patch{Year: 2024, Fields: map[string]any{"title": "ASTRO BOT", "publisher": "Sony"}}},
+		edit: func(r *core.Record) {
+			r.Set("title", "Astro Bot (edited)")
+			r.Set("publisher", "SIE")
+		},
+	}
+	app, queue, game := newTestQueue(t, enricher)
+	defer app.Cleanup()
+	enricher.app = app
+
+	if err := queue.enqueue("games", game.Id, []string{"title"}); err != nil {
+		t.Fatal(err)
+	}
+	job, err := queue.claim()
+	if err != nil || job == nil {
+		t.Fatalf("claim = %v, %v", job, err)
+	}
+	queue.run(job)
+
+	game, err = app.FindRecordById("games", game.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.GetString("title") != "Astro Bot (edited)" {
+		t.Errorf("title = %q, want the edit made during the lookup", game.GetString("title"))
+	}
+	if game.GetString("publisher") != "Sony" || game.GetInt("year") != 2024 {
+		t.Errorf("publisher, year = %q, %d; want the patch's", game.GetString("publisher"), game.GetInt("year"))
+	}
+}
+
+func TestJobQueuePrune(t *testing.T) {
+	app, queue, game := newTestQueue(t, &stubEnricher{name: "stub"})
+	defer app.Cleanup()
+
+	for range 4 {
+		if err := queue.enqueue("games", game.Id, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs, err := app.FindAllRecords(jobsCollection)
+	if err != nil || len(jobs) != 4 {
+		t.Fatalf("jobs = %d, %v; want 4", len(jobs), err)
+	}
+
+	old := types.NowDateTime().Add(-jobRetention - time.Hour).String()
+	states := []struct {
+		status  string
+		updated string
+		kept    bool
+	}{
+		{status: jobDone, updated: old},
+		{status: jobDone, updated: types.NowDateTime().String(), kept: true},
+		{status: jobDead, updated: old, kept: true},
+		{status: jobFailed, updated: old, kept: true},
+	}
+	for i, s := range states {
+		_, err := app.DB().Update(
+			jobsCollection,
+			dbx.Params{"status": s.status, "updated": s.updated},
+			dbx.HashExp{"id": jobs[i].Id},
+		).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := queue.prune(); err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range states {
+		_, err := app.FindRecordById(jobsCollection, jobs[i].Id)
+		if kept := err == nil; kept != s.kept {
+			t.Errorf("%s job updated %s: kept = %v, want %v", s.status, s.updated, kept, s.kept)
+		}
+	}
+}
+
+func TestJobQueueResume(t *testing.T) {
+	enricher := &stubEnricher{name: "stub", patch: Patch{Year: 2024}}
+	app, queue, game := newTestQueue(t, enricher)
+	defer app.Cleanup()
+
+	// A job claimed by a process that then died.
+	if err := queue.enqueue("games", game.Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	job, err := queue.claim()
+	if err != nil || job == nil {
+		t.Fatalf("claim = %v, %v", job, err)
+	}
+
+	restarted := newJobQueue(app, queue.enrichers)
+	if err := restarted.start(); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.stop()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for findJob(t, app, job.Id).GetString("status") != jobDone {
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %q after restart", findJob(t, app, job.Id).GetString("status"))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if attempts := findJob(t, app, job.Id).GetInt("attempts"); attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+	if calls := enricher.calls.Load(); calls != 1 {
+		t.Errorf("enricher ran %d times, want 1", calls)
+	}
+}
+
+func TestUpdateRequestEnqueuesJobs(t *testing.T) {
+	const (
+		gameID = "enrichedgame001"
+		cardID = "enrichedcard001"
+	)
+	headers := map[string]string{}
+
+	// factory returns a test app with an enriched game and MTG card, and fills
+	// headers with a user's token.
+	factory := func(t testing.TB) *tests.TestApp {
+		app := newTestApp(t)
+		if err := app.Save(schema.MtgCollection()); err != nil {
+			t.Fatal(err)
+		}
+
+		games, err := app.FindCollectionByNameOrId("games")
+		if err != nil {
+			t.Fatal(err)
+		}
+		game := core.NewRecord(games)
+		game.Id = gameID
+		game.Set("title", "Astro Bot")
+		game.Set("year", 2024)
+		game.Set("publisher", "Sony")
+		if err := app.Save(game); err != nil {
+			t.Fatal(err)
+		}
+
+		mtg, err := app.FindCollectionByNameOrId("mtg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		card := core.NewRecord(mtg)
+		card.Id = cardID
+		card.Set("name", "Lightning Bolt")
+		card.Set("set", "lea")
+		card.Set("collector_number", 161)
+		card.Set("rarity", "common")
+		if err := app.Save(card); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := app.FindAuthRecordByEmail("users", "test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := user.NewAuthToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers["Authorization"] = token
+
+		return app
+	}
+
+	// expectJobs checks the jobs queued by the request, by the fields each preserves,
+	// and the rarity stored on the card.
+	expectJobs := func(collection string, preserve []string, rarity string) func(t testing.TB, app *tests.TestApp, res *http.Response) {
+		return func(t testing.TB, app *tests.TestApp, res *http.Response) {
+			jobs, err := app.FindAllRecords(jobsCollection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if preserve == nil {
+				if len(jobs) != 0 {
+					t.Errorf("queued %d jobs, want none", len(jobs))
+				}
+			} else if len(jobs) != 1 {
+				t.Errorf("queued %d jobs, want 1", len(jobs))
+			} else {
+				var got []string
+				if err := jobs[0].UnmarshalJSONField("preserve", &got); err != nil {
+					t.Fatal(err)
+				}
+				if jobs[0].GetString("collection") != collection || jobs[0].GetString("status") != jobPending {
+					t.Errorf("job = %s %s, want a pending %s job", jobs[0].GetString("status"), jobs[0].GetString("collection"), collection)
+				}
+				if !slices.Equal(got, preserve) {
+					t.Errorf("preserve = %v, want %v", got, preserve)
+				}
+			}
+
+			card, err := app.FindRecordById("mtg", cardID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if card.GetString("rarity") != rarity {
+				t.Errorf("rarity = %q, want %q", card.GetString("rarity"), rarity)
+			}
+		}
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "unchanged lookup field queues nothing",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/games/records/" + gameID,
+			Body:            strings.NewReader(`{"title":"Astro Bot","publisher":"Team Asobi"}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"publisher":"Team Asobi"`},
+			TestAppFactory:  factory,
+			AfterTestFunc:   expectJobs("games", nil, "common"),
+		},
+		{
+			Name:            "changed lookup field queues a job preserving the edits",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/games/records/" + gameID,
+			Body:            strings.NewReader(`{"title":"Astro's Playroom","publisher":"Team Asobi"}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"title":"Astro's Playroom"`},
+			TestAppFactory:  factory,
+			AfterTestFunc:   expectJobs("games", []string{"title", "publisher"}, "common"),
+		},
+		{
+			Name:            "changed MTG set clears rarity",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/mtg/records/" + cardID,
+			Body:            strings.NewReader(`{"set":"2ed"}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"set":"2ed"`, `"rarity":""`},
+			TestAppFactory:  factory,
+			AfterTestFunc:   expectJobs("mtg", []string{"set"}, ""),
+		},
+		{
+			Name:            "changed MTG set keeps a rarity set in the same request",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/mtg/records/" + cardID,
+			Body:            strings.NewReader(`{"set":"2ed","rarity":"uncommon"}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"rarity":"uncommon"`},
+			TestAppFactory:  factory,
+			AfterTestFunc:   expectJobs("mtg", []string{"set", "rarity"}, "uncommon"),
+		},
+		{
+			Name:            "changed MTG name alone queues nothing",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/mtg/records/" + cardID,
+			Body:            strings.NewReader(`{"name":"Chain Lightning"}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"name":"Chain Lightning"`},
+			TestAppFactory:  factory,
+			AfterTestFunc:   expectJobs("mtg", nil, "common"),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestRegistryEnrich(t *testing.T) {
+	transient := &helpers.ProviderError{Provider: "igdb", StatusCode: http.StatusServiceUnavailable, Err: errors.New("unavailable")}
+	found := func(name, publisher string) *stubEnricher {
+		return &stubEnricher{name: name, patch: Patch{Fields: map[string]any{"publisher": publisher}}}
+	}
+
+	scenarios := []struct {
+		name      string
+		chain     []*stubEnricher
+		calls     []int32 // lookups per enricher
+		changed   bool
+		publisher string
+		year      int
+		errs      []error // each must be found in the returned error
+	}{
+		{
+			name:      "first match wins",
+			chain:     []*stubEnricher{found("first", "First"), found("second", "Second")},
+			calls:     []int32{1, 0},
+			changed:   true,
+			publisher: "First",
+			year:      2020,
+		},
+		{
+			name:      "no match falls back",
+			chain:     []*stubEnricher{{name: "first", err: errNoMatch}, found("second", "Second")},
+			calls:     []int32{1, 1},
+			changed:   true,
+			publisher: "Second",
+			year:      2020,
+		},
+		{
+			name:      "failure falls back",
+			chain:     []*stubEnricher{{name: "first", err: transient}, found("second", "Second")},
+			calls:     []int32{1, 1},
+			changed:   true,
+			publisher: "Second",
+			year:      2020,
+		},
+		{
+			name:      "every failure is joined",
+			chain:     []*stubEnricher{{name: "first", err: transient}, {name: "second", err: errNoMatch}, {name: "third", err: errBrokenEnricher}},
+			calls:     []int32{1, 1, 1},
+			publisher: "Sony",
+			year:      2020,
+			errs:      []error{transient, errBrokenEnricher},
+		},
+		{
+			name:      "no match anywhere is not an error",
+			chain:     []*stubEnricher{{name: "first", err: errNoMatch}, {name: "second", err: errNoMatch}},
+			calls:     []int32{1, 1},
+			publisher: "Sony",
+			year:      2020,
+		},
+		{
+			name:      "empty patch falls back",
+			chain:     []*stubEnricher{{name: "first", patch: Patch{Fields: map[string]any{"publisher": ""}}}, found("second", "Second")},
+			calls:     []int32{1, 1},
+			changed:   true,
+			publisher: "Second",
+			year:      2020,
+		},
+		{
+			name:      "zero values are left untouched",
+			chain:     []*stubEnricher{{name: "first", patch: Patch{Fields: map[string]any{"publisher": "", "barcode": "0711719", "genre": nil}}}},
+			calls:     []int32{1},
+			changed:   true,
+			publisher: "Sony",
+			year:      2020,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			app, assets := newTestAppWithAssets(t)
+			defer app.Cleanup()
+
+			reg := newRegistry(assets)
+			for _, enricher := range s.chain {
+				reg.Register("games", enricher)
+			}
+
+			game := saveGame(t, app, "Astro Bot", "")
+			game.Set("publisher", "Sony")
+			game.Set("year", 2020)
+
+			changed, err := reg.Enrich(game)
+			if changed != s.changed {
+				t.Errorf("changed = %v, want %v", changed, s.changed)
+			}
+			if len(s.errs) == 0 && err != nil {
+				t.Errorf("err = %v, want nil", err)
+			}
+			for _, want := range s.errs {
+				if !errors.Is(err, want) {
+					t.Errorf("err = %v, want it to wrap %v", err, want)
+				}
+			}
+			if len(s.errs) > 0 && strings.Contains(err.Error(), "no match") {
+				t.Errorf("err = %v, want no-match lookups left out", err)
+			}
+			for i, enricher := range s.chain {
+				if calls := enricher.calls.Load(); calls != s.calls[i] {
+					t.Errorf("%s looked up %d times, want %d", enricher.name, calls, s.calls[i])
+				}
+			}
+			if game.GetString("publisher") != s.publisher || game.GetInt("year") != s.year {
+				t.Errorf("publisher, year = %q, %d; want %q, %d", game.GetString("publisher"), game.GetInt("year"), s.publisher, s.year)
+			}
+		})
+	}
+}
+
+func TestReenrichSelection(t *testing.T) {
+	// Bookmarks seeded by the test, by ID: a complete one, one missing its archive,
+	// one whose archive check-assets found broken and one with a failed artifact.
+	const (
+		complete = "reenrichdone001"
+		missing  = "reenrichmiss001"
+		broken   = "reenrichbrok001"
+		failed   = "reenrichfail001"
+	)
+
+	scenarios := []struct {
+		name string
+		args []string
+		want []string // records enriched, or listed with --dry-run
+	}{
+		{name: "every record", args: nil, want: []string{broken, complete, failed, missing}},
+		{name: "filter", args: []string{"--filter", "title ~ 'Broken' || title ~ 'Missing'"}, want: []string{broken, missing}},
+		{name: "only missing", args: []string{"--only-missing"}, want: []string{missing}},
+		{name: "broken", args: []string{"--broken"}, want: []string{broken}},
+		{name: "failed", args: []string{"--failed"}, want: []string{failed}},
+		{name: "filters combine", args: []string{"--failed", "--broken"}, want: nil},
+		{name: "dry run", args: []string{"--dry-run", "--only-missing"}, want: []string{missing}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			app, assets := newTestAppWithAssets(t)
+			defer app.Cleanup()
+
+			tag, err := app.FindFirstRecordByData("meta", "name", "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			bookmarks, err := app.FindCollectionByNameOrId("bookmarks")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, seed := range []struct {
+				id, title, archive string
+				status             string
+			}{
+				{complete, "Complete", "https://example.com/complete.md", artifactOK},
+				{missing, "Missing", "", ""},
+				{broken, "Broken", "https://example.com/broken.md", artifactOK},
+				{failed, "Failed", "https://example.com/failed.md", artifactFailed},
+			} {
+				bookmark := core.NewRecord(bookmarks)
+				bookmark.Id = seed.id
+				bookmark.Load(map[string]any{
+					"title":   seed.title,
+					"creator": "me",
+					"url":     "https://example.com/" + seed.id,
+					"type":    "articles",
+					"tags":    []string{tag.Id},
+					"archive": seed.archive,
+				})
+				if seed.archive != "" {
+					bookmark.Set("archives", []archiveArtifact{
+						{Kind: archiveMarkdown, Status: artifactOK, URL: seed.archive},
+						{Kind: archiveWARC, Status: seed.status},
+					})
+				}
+				if err := app.Save(bookmark); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			checks, err := app.FindCollectionByNameOrId(assetChecksCollection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check := core.NewRecord(checks)
+			check.Load(map[string]any{
+				"collection": "bookmarks",
+				"record":     broken,
+				"field":      "archive",
+				"url":        "https://example.com/broken.md",
+				"status":     http.StatusNotFound,
+				"failures":   1,
+			})
+			if err := app.Save(check); err != nil {
+				t.Fatal(err)
+			}
+
+			enricher := &stubEnricher{name: "stub", patch: Patch{Fields: map[string]any{"creator": "enriched"}}}
+			reg := newRegistry(assets)
+			reg.Register("bookmarks", enricher)
+
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			cmd := newReenrichCmd(app, reg)
+			cmd.SetArgs(append([]string{"bookmarks"}, s.args...))
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := enricher.seen
+			if slices.Contains(s.args, "--dry-run") {
+				if len(got) != 0 {
+					t.Errorf("dry run enriched %v", got)
+				}
+				got = nil
+				for _, line := range strings.Split(logs.String(), "\n") {
+					if _, id, ok := strings.Cut(line, "would enrich bookmarks/"); ok {
+						got = append(got, id)
+					}
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, s.want) {
+				t.Errorf("selected %v, want %v", got, s.want)
+			}
+
+			edited, err := app.FindRecordsByFilter("bookmarks", "creator = 'enriched'", "id", 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved := len(s.want)
+			if slices.Contains(s.args, "--dry-run") {
+				saved = 0
+			}
+			if len(edited) != saved {
+				t.Errorf("saved %d records, want %d", len(edited), saved)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("_jobs")
+		if err != nil {
+			return err
+		}
+
+		if status, ok := collection.Fields.GetByName("status").(*core.SelectField); ok {
+			status.Values = []string{"pending", "running", "failed", "dead", "done"}
+		}
+		collection.Fields.Add(&core.TextField{Name: "provider"})
+		collection.Fields.Add(&core.DateField{Name: "run_after"})
+		collection.RemoveIndex("idx_jobs_status_created")
+		collection.AddIndex("idx_jobs_status_run_after", false, "status, run_after", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("_jobs")
+		if err != nil {
+			return err
+		}
+
+		if status, ok := collection.Fields.GetByName("status").(*core.SelectField); ok {
+			status.Values = []string{"pending", "running", "failed", "done"}
+		}
+		collection.Fields.RemoveByName("provider")
+		collection.Fields.RemoveByName("run_after")
+		collection.RemoveIndex("idx_jobs_status_run_after")
+		collection.AddIndex("idx_jobs_status_created", false, "status, created", "")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("_jobs")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.Add(&core.JSONField{Name: "preserve"})
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("_jobs")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("preserve")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/fourjuaneight/rivendell/schema"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		for _, name := range []string{"movies", "shows"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if errors.Is(err, sql.ErrNoRows) {
+				// Not created yet; the schema builders already include these fields.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			collection.Fields.Add(schema.TMDBFields()...)
+			if name == "shows" {
+				collection.Fields.Add(&core.TextField{Name: "creator"})
+			}
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, name := range []string{"movies", "shows"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, field := range schema.TMDBFields() {
+				collection.Fields.RemoveByName(field.GetName())
+			}
+			collection.Fields.RemoveByName("creator")
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
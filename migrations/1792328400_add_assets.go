@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"github.com/fourjuaneight/rivendell/schema"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		return app.Save(schema.AssetsCollection())
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("_assets")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
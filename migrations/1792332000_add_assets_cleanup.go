@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("_assets")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.Add(&core.TextField{Name: "file_id"})
+		collection.Fields.Add(&core.TextField{Name: "parent"})
+		collection.AddIndex("idx_assets_url", false, "url", "")
+		collection.AddIndex("idx_assets_parent", false, "parent", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("_assets")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("file_id")
+		collection.Fields.RemoveByName("parent")
+		collection.RemoveIndex("idx_assets_url")
+		collection.RemoveIndex("idx_assets_parent")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/fourjuaneight/rivendell/schema"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// assetFileFields lists, per collection, the file fields mirroring its asset URL fields.
+func assetFileFields(name string) []core.Field {
+	switch name {
+	case "bookmarks":
+		return schema.ArchiveFileFields()
+	case "mtg":
+		return []core.Field{schema.CoverFileField("image"), schema.CoverFileField("back")}
+	}
+	return []core.Field{schema.CoverFileField("cover")}
+}
+
+func init() {
+	collections := []string{"bookmarks", "books", "cds", "games", "movies", "mtg", "shows", "vinyls"}
+
+	m.Register(func(app core.App) error {
+		for _, name := range collections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if errors.Is(err, sql.ErrNoRows) {
+				// Not created yet; the schema builders already include these fields.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			collection.Fields.Add(assetFileFields(name)...)
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, name := range collections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, field := range assetFileFields(name) {
+				collection.Fields.RemoveByName(field.GetName())
+			}
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/fourjuaneight/rivendell/schema"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	collections := []string{"bookmarks", "feeds"}
+
+	m.Register(func(app core.App) error {
+		for _, name := range collections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if errors.Is(err, sql.ErrNoRows) {
+				// Not created yet; the schema builders already include these fields.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			collection.Fields.Add(schema.LinkCheckFields()...)
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, name := range collections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, field := range schema.LinkCheckFields() {
+				collection.Fields.RemoveByName(field.GetName())
+			}
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
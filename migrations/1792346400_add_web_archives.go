@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/fourjuaneight/rivendell/schema"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("bookmarks")
+		if errors.Is(err, sql.ErrNoRows) {
+			// Not created yet; the schema builder already includes these fields.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.Add(schema.WebArchiveFields()...)
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("bookmarks")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, field := range schema.WebArchiveFields() {
+			collection.Fields.RemoveByName(field.GetName())
+		}
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("bookmarks")
+		if errors.Is(err, sql.ErrNoRows) {
+			// Not created yet; the schema builder already includes this field.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.Add(&core.JSONField{Name: "archives"})
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("bookmarks")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("archives")
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"github.com/fourjuaneight/rivendell/schema"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// extractionRuleSeeds are the site rules that used to be hard-coded in GetArticle.
+var extractionRuleSeeds = []map[string]any{
+	{
+		"host": "wired.com",
+		"remove": []string{
+			"div.newsletter-subscribe-form",
+			"div[class^='RecircMostPopularContiner']",
+			"div[data-attr-viewport-monitor]",
+			"div[class^='NewsletterSubscribeFormWrapper']",
+			"div[data-testid='NewsletterSubscribeFormWrapper']",
+			"div[class^='GenericCalloutWrapper']",
+			"div[data-testid='GenericCallout']",
+			"aside[class^='Sidebar']",
+			"aside[data-testid='SidebarEmbed']",
+			"div[class^='ContributorsWrapper']",
+			"div[data-testid='Contributors']",
+		},
+		"replace": []map[string]string{{"pattern": "—+", "with": ""}},
+	},
+	{
+		"host": "theatlantic.com",
+		"remove": []string{
+			"p[class^='ArticleRelatedContentLink']",
+			"div[class^='ArticleRelatedContentModule']",
+			"div[class^='ArticleBooksModule']",
+		},
+	},
+	{
+		"host": "arstechnica.com",
+		"remove": []string{
+			"div.gallery",
+			"div.story-sidebar",
+		},
+	},
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection := schema.ExtractionRulesCollection()
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		for _, seed := range extractionRuleSeeds {
+			rule := core.NewRecord(collection)
+			rule.Load(seed)
+			if err := app.Save(rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("_extraction_rules")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// ConvertAssets attaches the assets existing records link by URL to their file
+// fields. The main package sets it, as the conversion needs its asset store; the
+// migration does nothing while it's unset (e.g. in the test app).
+var ConvertAssets func(app core.App) error
+
+func init() {
+	m.Register(func(app core.App) error {
+		if ConvertAssets == nil {
+			return nil
+		}
+		return ConvertAssets(app)
+	}, func(app core.App) error {
+		// The URL fields are left in place, so there's nothing to undo.
+		return nil
+	})
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/fourjuaneight/rivendell/helpers"
+	"github.com/fourjuaneight/rivendell/utils"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// coverAsset mirrors a provider cover image to {name}.jpeg in the collection folder.
+func coverAsset(url, name string) []Asset {
+	if url == "" {
+		return nil
+	}
+	return []Asset{{Field: "cover", URL: url, Filename: fmt.Sprintf("%s.jpeg", utils.FileNameFmt(name))}}
+}
+
+// ── Bookmarks ────────────────────────────────────────────────────────────────
+
+type bookmarkArchiver struct {
+	assets *assetStore
+}
+
+func (bookmarkArchiver) Name() string { return "archive" }
+
+func (b bookmarkArchiver) Lookup(r *core.Record) (Patch, error) {
+	fields, err := archive(b.assets, r.Id, r.GetString("title"), r.GetString("creator"), r.GetString("url"), r.GetString("type"), recordArtifacts(r))
+	if err != nil {
+		return Patch{}, fmt.Errorf("[bookmarkArchiver]: %w", err)
+	}
+	return Patch{Fields: fields}, nil
+}
+
+// ── GitHub ───────────────────────────────────────────────────────────────────
+
+type githubEnricher struct{}
+
+func (githubEnricher) Name() string { return "github" }
+
+func (githubEnricher) Lookup(r *core.Record) (Patch, error) {
+	repo, err := helpers.GetRepoInfo(r.GetString("url"))
+	if err != nil {
+		return Patch{}, fmt.Errorf("[githubEnricher]: %w", err)
+	}
+	return Patch{Fields: map[string]any{
+		"name":        repo.Name,
+		"owner":       repo.Owner,
+		"description": repo.Description,
+		"language":    repo.Language,
+	}}, nil
+}
+
+// ── MTG ──────────────────────────────────────────────────────────────────────
+
+type scryfallEnricher struct{}
+
+func (scryfallEnricher) Name() string { return "scryfall" }
+
+func (scryfallEnricher) Lookup(r *core.Record) (Patch, error) {
+	cardSelection, err := helpers.SearchCard(r.GetString("name"), r.GetString("set"), r.GetInt("collector_number"))
+	if err != nil {
+		return Patch{}, fmt.Errorf("[scryfallEnricher]: %w", err)
+	}
+
+	var card helpers.MTGItem
+	for _, c := range cardSelection {
+		card = c
+		break
+	}
+
+	var patch Patch
+
+	// Only overwrite card fields when caller didn't provide full data.
+	// rarity is a reliable sentinel — always set by Scryfall, never by the caller alone.
+	if r.GetString("rarity") == "" {
+		patch.Fields = map[string]any{
+			"colors":      card.Colors,
+			"type":        card.Type,
+			"set_name":    card.SetName,
+			"oracle_text": card.OracleText,
+			"flavor_text": card.FlavorText,
+			"rarity":      card.Rarity,
+			"artist":      card.Artist,
+			"released_at": card.ReleasedAt,
+		}
+	}
+
+	// Front image, plus the back face when present.
+	name := utils.FileNameFmt(r.GetString("name"))
+	patch.Assets = append(patch.Assets, Asset{
+		Field:    "image",
+		URL:      card.Image,
+		Filename: fmt.Sprintf("%s/%s.jpeg", r.GetString("set"), name),
+	})
+	if card.Back != nil {
+		patch.Assets = append(patch.Assets, Asset{
+			Field:    "back",
+			URL:      *card.Back,
+			Filename: fmt.Sprintf("%s/%s-back.jpeg", r.GetString("set"), name),
+		})
+	}
+
+	return patch, nil
+}
+
+// ── Books ────────────────────────────────────────────────────────────────────
+
+type openLibraryEnricher struct{}
+
+func (openLibraryEnricher) Name() string { return "openlibrary" }
+
+func (openLibraryEnricher) Lookup(r *core.Record) (Patch, error) {
+	isbn := r.GetString("isbn")
+	if isbn == "" {
+		return Patch{}, errNoMatch
+	}
+
+	book, err := helpers.GetBookInfo(isbn)
+	if err != nil {
+		// Older editions are sometimes only indexed under their ISBN-10.
+		isbn10, convErr := utils.ISBN13To10(isbn)
+		if convErr != nil || isbn10 == isbn {
+			return Patch{}, fmt.Errorf("[openLibraryEnricher]: %w", err)
+		}
+		if book, err = helpers.GetBookInfo(isbn10); err != nil {
+			return Patch{}, fmt.Errorf("[openLibraryEnricher]: %w", err)
+		}
+	}
+	return bookPatch(r, book), nil
+}
+
+// googleBooksEnricher is the fallback for books OpenLibrary doesn't know. Without an
+// ISBN it searches by title and author instead, and has no match when either is blank.
+type googleBooksEnricher struct{}
+
+func (googleBooksEnricher) Name() string { return "googlebooks" }
+
+func (googleBooksEnricher) Lookup(r *core.Record) (Patch, error) {
+	var (
+		book helpers.CleanBook
+		err  error
+	)
+	if isbn := r.GetString("isbn"); isbn != "" {
+		book, err = helpers.GetGoogleBookInfo(isbn)
+	} else {
+		book, err = helpers.SearchBookInfo(r.GetString("title"), r.GetString("author"))
+	}
+	if errors.Is(err, helpers.ErrIncompleteSearch) {
+		return Patch{}, errNoMatch
+	}
+	if err != nil {
+		return Patch{}, fmt.Errorf("[googleBooksEnricher]: %w", err)
+	}
+
+	return bookPatch(r, book), nil
+}
+
+// bookPatch builds the patch shared by the book providers. A record without an ISBN
+// gets the resolved ISBN-13 written back, converted from the ISBN-10 when that's all
+// the provider has.
+func bookPatch(r *core.Record, book helpers.CleanBook) Patch {
+	patch := Patch{Year: book.Year, Assets: coverAsset(book.CoverURL, r.GetString("title"))}
+	if r.GetString("isbn") != "" {
+		return patch
+	}
+
+	for _, candidate := range []string{book.ISBN13, book.ISBN10} {
+		if isbn13, err := utils.NormalizeISBN(candidate); err == nil {
+			patch.Fields = map[string]any{"isbn": isbn13}
+			break
+		}
+	}
+	return patch
+}
+
+// ── Music ────────────────────────────────────────────────────────────────────
+
+// discogsEnricher serves both cds and vinyls; mediaType selects the Discogs format filter.
+type discogsEnricher struct {
+	mediaType string
+}
+
+func (discogsEnricher) Name() string { return "discogs" }
+
+func (d discogsEnricher) Lookup(r *core.Record) (Patch, error) {
+	album := r.GetString("album")
+	music, err := helpers.GetMusicInfo(album, r.GetString("artist"), r.GetInt("year"), r.GetString("barcode"), d.mediaType)
+	if err != nil {
+		return Patch{}, fmt.Errorf("[discogsEnricher]: %w", err)
+	}
+	return Patch{Year: parseYear(music.Year), Assets: coverAsset(music.CoverURL, album)}, nil
+}
+
+// ── Games ────────────────────────────────────────────────────────────────────
+
+type igdbEnricher struct{}
+
+func (igdbEnricher) Name() string { return "igdb" }
+
+func (igdbEnricher) Lookup(r *core.Record) (Patch, error) {
+	title := r.GetString("title")
+	game, err := helpers.GetGameInfo(title, r.GetInt("year"))
+	if err != nil {
+		return Patch{}, fmt.Errorf("[igdbEnricher]: %w", err)
+	}
+	return Patch{Year: game.Year, Assets: coverAsset(game.CoverURL, title)}, nil
+}
+
+// ── Movies & shows ───────────────────────────────────────────────────────────
+
+// tmdbEnricher serves both movies and shows; mediaType selects the TMDB category.
+// app is used to resolve TMDB's genre into a meta record.
+type tmdbEnricher struct {
+	app       core.App
+	mediaType string
+}
+
+func (tmdbEnricher) Name() string { return "tmdb" }
+
+func (t tmdbEnricher) Lookup(r *core.Record) (Patch, error) {
+	title := r.GetString("title")
+	season := 0
+	if t.mediaType == "shows" {
+		season = r.GetInt("season")
+	}
+
+	media, err := helpers.SearchMedia(title, r.GetInt("year"), season, t.mediaType)
+	if err != nil {
+		return Patch{}, fmt.Errorf("[tmdbEnricher]: %w", err)
+	}
+
+	fields := map[string]any{
+		"tmdb_id":  media.TMDBID,
+		"imdb_id":  media.IMDbID,
+		"overview": media.Overview,
+		"runtime":  media.Runtime,
+	}
+
+	// Movies have directors; shows have creators. A name the caller sent is kept.
+	creatorField := "director"
+	if t.mediaType == "shows" {
+		creatorField = "creator"
+	}
+	if r.GetString(creatorField) == "" && media.Creator != "" {
+		fields[creatorField] = media.Creator
+	}
+
+	// Only fill the genre when the caller didn't pick one. A genre the meta policy
+	// can't resolve is left blank rather than failing the enrichment.
+	if r.GetString("genre") == "" && media.Genre != "" {
+		id, err := resolveMetaName(t.app, media.Genre, "genre")
+		if err != nil {
+			log.Printf("[tmdbEnricher] %s/%s genre: %v", t.mediaType, r.Id, err)
+		} else {
+			fields["genre"] = id
+		}
+	}
+
+	return Patch{
+		Year:   parseYear(media.Year),
+		Fields: fields,
+		Assets: coverAsset(media.CoverURL, title),
+	}, nil
+}
+
+// ── Watch later ──────────────────────────────────────────────────────────────
+
+type youtubeEnricher struct{}
+
+func (youtubeEnricher) Name() string { return "youtube" }
+
+func (youtubeEnricher) Lookup(r *core.Record) (Patch, error) {
+	yt, err := helpers.GetYTInfo(r.GetString("link"))
+	if err != nil {
+		return Patch{}, fmt.Errorf("[youtubeEnricher]: %w", err)
+	}
+	return Patch{Fields: map[string]any{
+		"title":   yt.Title,
+		"channel": yt.Creator,
+	}}, nil
+}
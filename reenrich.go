@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// enrichedFields lists, per collection, the fields an enricher is expected to fill.
+// A record with any of them blank counts as "missing" for `reenrich --only-missing`.
+var enrichedFields = map[string][]string{
+	"bookmarks":   {"archive", "archives"},
+	"github":      {"name", "owner", "language"},
+	"mtg":         {"rarity", "image"},
+	"books":       {"year", "cover"},
+	"cds":         {"year", "cover"},
+	"games":       {"year", "cover"},
+	"movies":      {"year", "cover", "tmdb_id"},
+	"shows":       {"year", "cover", "tmdb_id"},
+	"vinyls":      {"year", "cover"},
+	"watch_later": {"title", "channel"},
+}
+
+// isMissingEnrichment reports whether any of the collection's enriched fields is blank.
+// An asset URL field counts as filled when its file field holds the file instead.
+func isMissingEnrichment(r *core.Record, collection string) bool {
+	for _, field := range enrichedFields[collection] {
+		if r.GetString(field+"_file") != "" {
+			continue
+		}
+		switch v := r.Get(field).(type) {
+		case nil:
+			return true
+		case string:
+			if v == "" {
+				return true
+			}
+		case float64:
+			if v == 0 {
+				return true
+			}
+		case int:
+			if v == 0 {
+				return true
+			}
+		case types.JSONRaw:
+			if len(v) == 0 || v.String() == "null" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newReenrichCmd builds the `reenrich` command, which runs a collection's enricher
+// synchronously over existing records — for backfills after a new enricher is added,
+// or to retry records whose cover/year came back empty.
+func newReenrichCmd(app core.App, enrichers *Registry) *cobra.Command {
+	var (
+		filter      string
+		onlyMissing bool
+		broken      bool
+		failedOnly  bool
+		dryRun      bool
+		concurrency int
+	)
+
+	cmd := &cobra.Command{
+		Use:          "reenrich <collection>",
+		Short:        "Re-run the enricher over existing records in a collection",
+		Long:         fmt.Sprintf("Re-run the enricher over existing records in a collection.\n\nCollections: %s", strings.Join(enrichers.Collections(), ", ")),
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			collection := args[0]
+			if !enrichers.Has(collection) {
+				return fmt.Errorf("[reenrich]: no enricher for %q", collection)
+			}
+			if concurrency < 1 {
+				concurrency = 1
+			}
+
+			records, err := app.FindRecordsByFilter(collection, filter, "id", 0, 0)
+			if err != nil {
+				return fmt.Errorf("[reenrich][FindRecordsByFilter]: %w", err)
+			}
+
+			var brokenIDs map[string]bool
+			if broken {
+				if brokenIDs, err = brokenRecords(app, collection); err != nil {
+					return fmt.Errorf("[reenrich]%w", err)
+				}
+			}
+
+			var selected []*core.Record
+			for _, r := range records {
+				if onlyMissing && !isMissingEnrichment(r, collection) {
+					continue
+				}
+				if broken && !brokenIDs[r.Id] {
+					continue
+				}
+				if failedOnly && !hasFailedArtifacts(r) {
+					continue
+				}
+				selected = append(selected, r)
+			}
+
+			log.Printf("[reenrich] %s: %d matched, %d selected", collection, len(records), len(selected))
+
+			if dryRun {
+				for _, r := range selected {
+					log.Printf("[reenrich] would enrich %s/%s", collection, r.Id)
+				}
+				return nil
+			}
+
+			var (
+				done    atomic.Int64
+				updated atomic.Int64
+				failed  atomic.Int64
+				wg      sync.WaitGroup
+				sem     = make(chan struct{}, concurrency)
+			)
+
+			for _, r := range selected {
+				wg.Add(1)
+				sem <- struct{}{}
+				go func(r *core.Record) {
+					defer wg.Done()
+					defer func() { <-sem }()
+
+					saved, err := applyEnricher(app, enrichers.Enrich, r)
+					n := done.Add(1)
+					switch {
+					case err != nil:
+						failed.Add(1)
+						log.Printf("[reenrich] %d/%d %s/%s: %v", n, len(selected), collection, r.Id, err)
+					case saved:
+						updated.Add(1)
+						log.Printf("[reenrich] %d/%d %s/%s: updated", n, len(selected), collection, r.Id)
+					default:
+						log.Printf("[reenrich] %d/%d %s/%s: unchanged", n, len(selected), collection, r.Id)
+					}
+				}(r)
+			}
+			wg.Wait()
+
+			log.Printf(
+				"[reenrich] %s: %d processed, %d updated, %d unchanged, %d failed",
+				collection, done.Load(), updated.Load(), done.Load()-updated.Load()-failed.Load(), failed.Load(),
+			)
+
+			if failed.Load() > 0 {
+				return fmt.Errorf("[reenrich]: %d of %d records failed", failed.Load(), len(selected))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&filter, "filter", "", "PocketBase filter expression to select records (e.g. 'year = 0')")
+	cmd.Flags().BoolVar(&onlyMissing, "only-missing", false, "only enrich records with a blank enriched field (cover, year, archive, ...)")
+	cmd.Flags().BoolVar(&broken, "broken", false, "only enrich records whose archive or cover the last check-assets run found broken")
+	cmd.Flags().BoolVar(&failedOnly, "failed", false, "only enrich bookmarks with an archive artifact that failed (see the archives field)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the records that would be enriched without calling any external API")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "number of records to enrich in parallel")
+
+	return cmd
+}
@@ -1,6 +1,8 @@
 package schema
 
 import (
+	"errors"
+	"io/fs"
 	"log"
 	"os"
 	"sync"
@@ -21,7 +23,8 @@ func GetMetaID() string {
 			log.Fatal(err)
 		}
 
-		if err := godotenv.Load(path + "/.env"); err != nil {
+		// META_ID may come from the environment alone when there's no .env.
+		if err := godotenv.Load(path + "/.env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
 			log.Fatal(err)
 		}
 
@@ -49,6 +52,9 @@ func BookmarksCollection() *core.Collection {
 	collection.Fields.Add(&core.TextField{Name: "creator", Required: true})
 	collection.Fields.Add(&core.URLField{Name: "url", Required: true})
 	collection.Fields.Add(&core.URLField{Name: "archive"})
+	collection.Fields.Add(ArchiveFileFields()...)
+	collection.Fields.Add(WebArchiveFields()...)
+	collection.Fields.Add(&core.JSONField{Name: "archives"})
 	collection.Fields.Add(&core.RelationField{
 		Name:         "tags",
 		Required:     true,
@@ -62,6 +68,7 @@ func BookmarksCollection() *core.Collection {
 		MaxSelect: 1,
 	})
 	collection.Fields.Add(&core.BoolField{Name: "dead"})
+	collection.Fields.Add(LinkCheckFields()...)
 	collection.Fields.Add(&core.BoolField{Name: "shared"})
 	collection.Fields.Add(&core.BoolField{Name: "favorite"})
 	collection.Fields.Add(&core.TextField{Name: "comments"})
@@ -93,12 +100,24 @@ func FeedsCollection() *core.Collection {
 		MaxSelect: 1,
 	})
 	collection.Fields.Add(&core.BoolField{Name: "dead"})
+	collection.Fields.Add(LinkCheckFields()...)
 	collection.Fields.Add(&core.BoolField{Name: "shared"})
 	collection.Fields.Add(&core.TextField{Name: "comments"})
 
 	return collection
 }
 
+// LinkCheckFields hold the link checker's last result for a bookmark or feed; `dead`
+// is set from link_failures.
+func LinkCheckFields() []core.Field {
+	return []core.Field{
+		&core.NumberField{Name: "link_status", OnlyInt: true},
+		&core.TextField{Name: "link_error"},
+		&core.NumberField{Name: "link_failures", OnlyInt: true},
+		&core.DateField{Name: "link_checked"},
+	}
+}
+
 func BooksCollection() *core.Collection {
 	collection := core.NewBaseCollection("books")
 	authRule := "@request.auth.id != ''"
@@ -118,6 +137,7 @@ func BooksCollection() *core.Collection {
 	})
 	collection.Fields.Add(&core.NumberField{Name: "year"})
 	collection.Fields.Add(&core.URLField{Name: "cover"})
+	collection.Fields.Add(CoverFileField("cover"))
 	collection.Fields.Add(&core.TextField{Name: "comments"})
 
 	return collection
@@ -142,6 +162,7 @@ func CdsCollection() *core.Collection {
 	})
 	collection.Fields.Add(&core.NumberField{Name: "year"})
 	collection.Fields.Add(&core.URLField{Name: "cover"})
+	collection.Fields.Add(CoverFileField("cover"))
 	collection.Fields.Add(&core.TextField{Name: "comments"})
 
 	return collection
@@ -173,6 +194,7 @@ func GamesCollection() *core.Collection {
 	})
 	collection.Fields.Add(&core.NumberField{Name: "year"})
 	collection.Fields.Add(&core.URLField{Name: "cover"})
+	collection.Fields.Add(CoverFileField("cover"))
 	collection.Fields.Add(&core.TextField{Name: "comments"})
 
 	return collection
@@ -204,7 +226,9 @@ func MoviesCollection() *core.Collection {
 	})
 	collection.Fields.Add(&core.NumberField{Name: "year"})
 	collection.Fields.Add(&core.URLField{Name: "cover"})
+	collection.Fields.Add(CoverFileField("cover"))
 	collection.Fields.Add(&core.TextField{Name: "comments"})
+	collection.Fields.Add(TMDBFields()...)
 
 	return collection
 }
@@ -218,6 +242,7 @@ func ShowsCollection() *core.Collection {
 
 	collection.Fields.Add(&core.TextField{Name: "title", Required: true})
 	collection.Fields.Add(&core.TextField{Name: "director"})
+	collection.Fields.Add(&core.TextField{Name: "creator"})
 	collection.Fields.Add(&core.RelationField{
 		Name:          "genre",
 		Required:      false,
@@ -236,11 +261,56 @@ func ShowsCollection() *core.Collection {
 	collection.Fields.Add(&core.NumberField{Name: "year"})
 	collection.Fields.Add(&core.TextField{Name: "barcode"})
 	collection.Fields.Add(&core.URLField{Name: "cover"})
+	collection.Fields.Add(CoverFileField("cover"))
 	collection.Fields.Add(&core.TextField{Name: "comments"})
+	collection.Fields.Add(TMDBFields()...)
 
 	return collection
 }
 
+// CoverThumbs are the thumbnail sizes PocketBase generates for cover files, by width
+// with the aspect ratio kept.
+var CoverThumbs = []string{"150x0", "300x0", "600x0"}
+
+// CoverFileField holds the file form of the image URL field name (e.g. "cover" →
+// "cover_file"), used when ASSET_STORAGE=file.
+func CoverFileField(name string) *core.FileField {
+	return &core.FileField{
+		Name:      name + "_file",
+		MaxSelect: 1,
+		MaxSize:   20 << 20,
+		Thumbs:    CoverThumbs,
+	}
+}
+
+// ArchiveFileFields hold a bookmark's archive and, for articles, its SingleFile
+// snapshot when ASSET_STORAGE=file.
+func ArchiveFileFields() []core.Field {
+	return []core.Field{
+		&core.FileField{Name: "archive_file", MaxSelect: 1, MaxSize: 4 << 30},
+		&core.FileField{Name: "snapshot_file", MaxSelect: 1, MaxSize: 100 << 20},
+	}
+}
+
+// WebArchiveFields hold an article's WARC capture when ASSET_STORAGE=file (it's a
+// tracked asset next to the archive otherwise) and its Save Page Now snapshot.
+func WebArchiveFields() []core.Field {
+	return []core.Field{
+		&core.FileField{Name: "warc_file", MaxSelect: 1, MaxSize: 100 << 20},
+		&core.URLField{Name: "wayback"},
+	}
+}
+
+// TMDBFields are the metadata fields the TMDB enricher fills on movies and shows.
+func TMDBFields() []core.Field {
+	return []core.Field{
+		&core.NumberField{Name: "tmdb_id", OnlyInt: true},
+		&core.TextField{Name: "imdb_id"},
+		&core.TextField{Name: "overview"},
+		&core.NumberField{Name: "runtime", OnlyInt: true},
+	}
+}
+
 func VinylsCollection() *core.Collection {
 	collection := core.NewBaseCollection("vinyls")
 	authRule := "@request.auth.id != ''"
@@ -260,6 +330,7 @@ func VinylsCollection() *core.Collection {
 	})
 	collection.Fields.Add(&core.NumberField{Name: "year"})
 	collection.Fields.Add(&core.URLField{Name: "cover"})
+	collection.Fields.Add(CoverFileField("cover"))
 	collection.Fields.Add(&core.TextField{Name: "comments"})
 
 	return collection
@@ -285,6 +356,7 @@ func MtgCollection() *core.Collection {
 	collection.Fields.Add(&core.TextField{Name: "released_at"})
 	collection.Fields.Add(&core.TextField{Name: "image"})
 	collection.Fields.Add(&core.TextField{Name: "back"})
+	collection.Fields.Add(CoverFileField("image"), CoverFileField("back"))
 
 	return collection
 }
@@ -383,3 +455,88 @@ func MetaCollection() *core.Collection {
 
 	return collection
 }
+
+// JobsCollection backs the background enrichment queue. No API rules are set, so
+// only superusers can list or inspect jobs through the REST API and admin UI.
+func JobsCollection() *core.Collection {
+	collection := core.NewBaseCollection("_jobs")
+
+	collection.Fields.Add(&core.TextField{Name: "collection", Required: true})
+	collection.Fields.Add(&core.TextField{Name: "record", Required: true})
+	collection.Fields.Add(&core.SelectField{
+		Name:      "status",
+		Required:  true,
+		Values:    []string{"pending", "running", "failed", "dead", "done"},
+		MaxSelect: 1,
+	})
+	collection.Fields.Add(&core.NumberField{Name: "attempts", OnlyInt: true})
+	collection.Fields.Add(&core.TextField{Name: "last_error"})
+	collection.Fields.Add(&core.TextField{Name: "provider"})
+	collection.Fields.Add(&core.DateField{Name: "run_after"})
+	collection.Fields.Add(&core.JSONField{Name: "preserve"})
+	collection.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+	collection.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+	collection.AddIndex("idx_jobs_status_run_after", false, "status, run_after", "")
+
+	return collection
+}
+
+// AssetsCollection maps the SHA-1 of every archived file or mirrored cover to where it
+// was stored, so identical content is uploaded once. parent and owners link an
+// asset to the archives it accompanies, so it's deleted with the last of them.
+// Superusers only.
+func AssetsCollection() *core.Collection {
+	collection := core.NewBaseCollection("_assets")
+
+	collection.Fields.Add(&core.TextField{Name: "hash", Required: true})
+	collection.Fields.Add(&core.TextField{Name: "key", Required: true})
+	collection.Fields.Add(&core.URLField{Name: "url", Required: true})
+	collection.Fields.Add(&core.TextField{Name: "file_id"})
+	collection.Fields.Add(&core.TextField{Name: "parent"})
+	collection.Fields.Add(&core.JSONField{Name: "owners"})
+	collection.Fields.Add(&core.NumberField{Name: "size", OnlyInt: true})
+	collection.Fields.Add(&core.TextField{Name: "content_type"})
+	collection.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+	collection.AddIndex("idx_assets_hash", true, "hash", "")
+	collection.AddIndex("idx_assets_url", false, "url", "")
+	collection.AddIndex("idx_assets_parent", false, "parent", "")
+
+	return collection
+}
+
+// AssetChecksCollection records archives and covers the health check found broken:
+// one row per record field, removed once the asset is reachable again. Superusers only.
+func AssetChecksCollection() *core.Collection {
+	collection := core.NewBaseCollection("_asset_checks")
+
+	collection.Fields.Add(&core.TextField{Name: "collection", Required: true})
+	collection.Fields.Add(&core.TextField{Name: "record", Required: true})
+	collection.Fields.Add(&core.TextField{Name: "field", Required: true})
+	collection.Fields.Add(&core.URLField{Name: "url", Required: true})
+	collection.Fields.Add(&core.NumberField{Name: "status", OnlyInt: true})
+	collection.Fields.Add(&core.TextField{Name: "error"})
+	collection.Fields.Add(&core.NumberField{Name: "failures", OnlyInt: true})
+	collection.Fields.Add(&core.DateField{Name: "checked"})
+	collection.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+	collection.AddIndex("idx_asset_checks_record_field", true, "collection, record, field", "")
+
+	return collection
+}
+
+// ExtractionRulesCollection holds per-site rules for extracting articles (selectors to
+// remove or keep, text replacements, whether to keep images), matched by host.
+// Superusers only; edits apply to the next archived article.
+func ExtractionRulesCollection() *core.Collection {
+	collection := core.NewBaseCollection("_extraction_rules")
+
+	collection.Fields.Add(&core.TextField{Name: "host", Required: true})
+	collection.Fields.Add(&core.JSONField{Name: "remove"})
+	collection.Fields.Add(&core.JSONField{Name: "keep"})
+	collection.Fields.Add(&core.JSONField{Name: "replace"})
+	collection.Fields.Add(&core.BoolField{Name: "keep_images"})
+	collection.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+	collection.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+	collection.AddIndex("idx_extraction_rules_host", true, "host", "")
+
+	return collection
+}
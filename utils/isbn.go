@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrISBNLength   = errors.New("ISBN must have 10 or 13 digits")
+	ErrISBNChars    = errors.New("ISBN contains invalid characters")
+	ErrISBNChecksum = errors.New("ISBN check digit does not match")
+	ErrISBNPrefix   = errors.New("ISBN-13 has no ISBN-10 equivalent")
+)
+
+// cleanISBN strips the separators people usually type (dashes, spaces) and upper-cases
+// a trailing x check digit.
+func cleanISBN(isbn string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(isbn)))
+}
+
+// isbn10CheckDigit computes the check digit for the first 9 digits of an ISBN-10.
+func isbn10CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(digits[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// isbn13CheckDigit computes the check digit for the first 12 digits of an ISBN-13.
+func isbn13CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(digits[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func allDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeISBN validates an ISBN-10 or ISBN-13 and returns its canonical ISBN-13,
+// digits only.
+func NormalizeISBN(isbn string) (string, error) {
+	clean := cleanISBN(isbn)
+
+	switch len(clean) {
+	case 10:
+		if !allDigits(clean[:9]) || !(allDigits(clean[9:]) || clean[9] == 'X') {
+			return "", ErrISBNChars
+		}
+		if isbn10CheckDigit(clean) != clean[9] {
+			return "", ErrISBNChecksum
+		}
+		body := "978" + clean[:9]
+		return body + string(isbn13CheckDigit(body)), nil
+	case 13:
+		if !allDigits(clean) {
+			return "", ErrISBNChars
+		}
+		if isbn13CheckDigit(clean) != clean[12] {
+			return "", ErrISBNChecksum
+		}
+		return clean, nil
+	}
+
+	return "", ErrISBNLength
+}
+
+// ISBN13To10 converts a valid ISBN-10 or ISBN-13 to ISBN-10. Only 978-prefixed
+// ISBN-13s have an ISBN-10 equivalent.
+func ISBN13To10(isbn string) (string, error) {
+	isbn13, err := NormalizeISBN(isbn)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(isbn13, "978") {
+		return "", ErrISBNPrefix
+	}
+
+	body := isbn13[3:12]
+	return body + string(isbn10CheckDigit(body)), nil
+}
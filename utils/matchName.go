@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// NormalizeName lower-cases a name and collapses every run of whitespace and
+// punctuation into a single space, so "Sci-Fi", "sci fi" and " SCI_FI " compare equal.
+func NormalizeName(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// fuzzyCharsPerEdit caps how far a fuzzy match may be from the name: one edit per
+// this many characters of the longer of the two. Subsequence matching alone would
+// pair "Pop" with "Hip-Hop" or "Rap" with "Trap".
+const fuzzyCharsPerEdit = 3
+
+// MatchName returns the index of the candidate matching name, or -1. An exact match
+// after normalization always wins; with fuzzy set, the best fuzzy match close enough
+// to the name (see fuzzyCharsPerEdit) is used otherwise.
+func MatchName(candidates []string, name string, fuzzyMatch bool) int {
+	target := NormalizeName(name)
+	if target == "" {
+		return -1
+	}
+
+	normalized := make([]string, len(candidates))
+	for i, c := range candidates {
+		normalized[i] = NormalizeName(c)
+		if normalized[i] == target {
+			return i
+		}
+	}
+
+	if !fuzzyMatch {
+		return -1
+	}
+	for _, match := range fuzzy.Find(target, normalized) {
+		if closeName(target, normalized[match.Index]) {
+			return match.Index
+		}
+	}
+	return -1
+}
+
+// closeName reports whether two normalized names start alike and are within
+// fuzzyCharsPerEdit of each other, ignoring spaces so "scifi" is close to "sci fi".
+func closeName(a, b string) bool {
+	ra := []rune(strings.ReplaceAll(a, " ", ""))
+	rb := []rune(strings.ReplaceAll(b, " ", ""))
+	if len(ra) == 0 || len(rb) == 0 || ra[0] != rb[0] {
+		return false
+	}
+	return editDistance(ra, rb)*fuzzyCharsPerEdit <= max(len(ra), len(rb))
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -108,3 +108,124 @@ func TestGetFileType(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"ISBN-13 passthrough", "9780441172719", "9780441172719", nil},
+		{"ISBN-13 with dashes", "978-0-441-17271-9", "9780441172719", nil},
+		{"ISBN-10 converted", "0441172717", "9780441172719", nil},
+		{"ISBN-10 with spaces", "0 441 17271 7", "9780441172719", nil},
+		{"ISBN-10 with X check digit", "080442957X", "9780804429573", nil},
+		{"ISBN-10 with lowercase x", "080442957x", "9780804429573", nil},
+		{"979 ISBN-13", "9791032305690", "9791032305690", nil},
+		{"ISBN-13 bad check digit", "9780441172718", "", ErrISBNChecksum},
+		{"ISBN-10 bad check digit", "0441172718", "", ErrISBNChecksum},
+		{"X outside check digit", "04411727X7", "", ErrISBNChars},
+		{"letters", "97804411727AB", "", ErrISBNChars},
+		{"too short", "12345", "", ErrISBNLength},
+		{"empty string", "", "", ErrISBNLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeISBN(tt.input)
+			if err != tt.wantErr {
+				t.Fatalf("NormalizeISBN(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeISBN(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestISBN13To10(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"978 ISBN-13", "9780441172719", "0441172717", nil},
+		{"X check digit", "9780804429573", "080442957X", nil},
+		{"ISBN-10 round trip", "0-441-17271-7", "0441172717", nil},
+		{"979 prefix has no ISBN-10", "9791032305690", "", ErrISBNPrefix},
+		{"invalid ISBN", "9780441172718", "", ErrISBNChecksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ISBN13To10(tt.input)
+			if err != tt.wantErr {
+				t.Fatalf("ISBN13To10(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ISBN13To10(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"lowercased", "Drama", "drama"},
+		{"dash to space", "Sci-Fi", "sci fi"},
+		{"underscore to space", "sci_fi", "sci fi"},
+		{"whitespace collapsed and trimmed", "  sci \t fi  ", "sci fi"},
+		{"punctuation stripped", "Rock & Roll!", "rock roll"},
+		{"digits kept", "4K", "4k"},
+		{"accented letters kept", "Café", "café"},
+		{"empty string", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeName(tt.input); got != tt.want {
+				t.Errorf("NormalizeName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	candidates := []string{"Drama", "Sci-Fi", "Science Fiction", "Horror", "Hip-Hop", "Trap", "Documentary"}
+
+	tests := []struct {
+		name  string
+		input string
+		fuzzy bool
+		want  int
+	}{
+		{"exact match", "Drama", false, 0},
+		{"case-insensitive", "drama", false, 0},
+		{"separator-insensitive", "sci fi", false, 1},
+		{"exact wins over fuzzy", "Sci Fi", true, 1},
+		{"no match when strict", "scifi", false, -1},
+		{"fuzzy match", "scifi", true, 1},
+		{"fuzzy prefix", "horr", true, 3},
+		{"fuzzy typo", "documentry", true, 6},
+		{"no fuzzy match", "western", true, -1},
+		{"letters in order aren't enough", "Pop", true, -1},
+		{"too short to be a typo", "Rap", true, -1},
+		{"too far from the candidate", "Sci", true, -1},
+		{"different first letter", "ocumentary", true, -1},
+		{"empty name", "  ", true, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchName(candidates, tt.input, tt.fuzzy); got != tt.want {
+				t.Errorf("MatchName(%q, fuzzy=%v) = %d, want %d", tt.input, tt.fuzzy, got, tt.want)
+			}
+		})
+	}
+}